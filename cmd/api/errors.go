@@ -7,8 +7,15 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// newErrorHandler returns the error handler producing standardized responses
+func newErrorHandler(cfg *config.Config) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		return errorHandler(c, err, cfg)
+	}
+}
+
 // errorHandler handles errors and returns standardized responses
-func errorHandler(c *fiber.Ctx, err error) error {
+func errorHandler(c *fiber.Ctx, err error, cfg *config.Config) error {
 	code := fiber.StatusInternalServerError
 	message := "Internal Server Error"
 	errorCode := "internal_error"
@@ -39,8 +46,8 @@ func errorHandler(c *fiber.Ctx, err error) error {
 		}
 	}
 
-	// Hide internal error details in production
-	if code >= 500 && config.IS_PROD {
+	// Hide internal error details unless disabled for the profile
+	if code >= 500 && cfg.MaskErrors {
 		message = "An internal server error occurred"
 	}
 
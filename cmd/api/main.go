@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,50 +9,118 @@ import (
 
 	"go-boilerplate-api/internal/api/config"
 	"go-boilerplate-api/internal/api/db"
+	_ "go-boilerplate-api/internal/api/db/datamigrations" // Registers the Go data migrations
+	"go-boilerplate-api/internal/api/health"
+	"go-boilerplate-api/internal/api/jobs"
+	"go-boilerplate-api/internal/api/logger"
 	"go-boilerplate-api/internal/api/middlewares"
 	"go-boilerplate-api/internal/api/routes"
+	"go-boilerplate-api/internal/api/tracing"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
 	// Load configuration
-	err := config.LoadEnvFile()
+	opts := config.Options{Args: os.Args[1:]}
+	cfg, err := config.LoadWithOptions(opts)
 	if err != nil {
-		log.Fatalf("Failed to load env file: %v", err)
+		// The application logger is built from the configuration, fall back to the defaults
+		bootLog := logger.New(logger.Options{})
+		bootLog.Fatal().Err(err).Msg("Failed to load config")
 	}
 
-	err = config.LoadAllConfig()
+	// The application logger is injected through ctx and the middleware stack
+	log := logger.Init(logger.Options{
+		Level:       cfg.LogLevel.ZerologLevel(),
+		Format:      cfg.LogFormat,
+		SampleEvery: uint32(cfg.LogSampleEvery),
+	})
+
+	ctx, stop := context.WithCancel(log.WithContext(context.Background()))
+	defer stop()
+
+	// Tracing is installed before the database and Redis clients so they pick up the provider
+	shutdownTracing, err := tracing.Init(ctx, tracing.Options{
+		Exporter:     cfg.TracingExporter,
+		ServiceName:  cfg.TracingServiceName,
+		Environment:  cfg.AppEnv,
+		SampleRatio:  cfg.TracingSampleRatio,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+	})
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		log.Fatal().Err(err).Msg("Failed to initialize tracing")
 	}
 
-	ctx := context.Background()
+	// Reloadable settings are re-applied on SIGHUP or config file change
+	reloader := config.NewReloader(cfg, opts, log)
+	reloader.Subscribe(func(next *config.Config) (func(), error) {
+		level := next.LogLevel.ZerologLevel()
+		return func() { logger.SetLevel(level) }, nil
+	})
 
-	if config.DATABASE_URL != "" {
-		err = db.InitPostgres(ctx, config.DATABASE_URL)
+	// Postgres failures make the instance not ready, Redis failures only degrade it
+	healthRegistry := health.NewRegistry(cfg.HealthCacheTTL, cfg.HealthCheckTimeout)
+
+	if cfg.DatabaseURL != "" {
+		poolOptions := db.PoolOptions{
+			MaxConns:           int32(cfg.DBMaxConns),
+			MinConns:           int32(cfg.DBMinConns),
+			MaxConnLifetime:    cfg.DBMaxConnLifetime,
+			MaxConnIdleTime:    cfg.DBMaxConnIdleTime,
+			ConnectTimeout:     cfg.DBConnectTimeout,
+			ApplicationName:    cfg.DBApplicationName,
+			StatementCacheMode: cfg.DBStatementCacheMode,
+			PgBouncer:          cfg.DBPgBouncer,
+		}
+		err = db.InitPostgres(ctx, cfg.DatabaseURL, poolOptions, db.QueryLogOptions{
+			SlowThreshold:     cfg.DBSlowQueryThreshold,
+			LogParams:         cfg.DBLogParams,
+			NPlusOneThreshold: cfg.DBNPlusOneThreshold,
+		})
 		if err != nil {
-			log.Fatalf("Failed to initialize PostgreSQL: %v", err)
+			log.Fatal().Err(err).Msg("Failed to initialize PostgreSQL")
 		}
 		defer db.ClosePostgres()
+		healthRegistry.Register("postgres", health.Critical, 0, health.PostgresChecker())
 
-		if err = db.RunMigrations(ctx, config.DATABASE_URL); err != nil {
-			log.Fatalf("Failed to run database migrations: %v", err)
+		err = db.MigrateOnStartup(ctx, cfg.DatabaseURL, db.StartupMigrationOptions{
+			Mode:        cfg.MigrateOnStartup,
+			LockTimeout: cfg.MigrateLockTimeout,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Str("mode", cfg.MigrateOnStartup).Msg("Database schema is not ready, refusing to start")
 		}
+
+		// Reads go to the replicas once the schema is ready, replica outages only degrade the instance
+		if urls := cfg.ReplicaURLs(); len(urls) > 0 {
+			err = db.InitReplicas(ctx, urls, db.ReplicaOptions{
+				Pool:           poolOptions,
+				HealthInterval: cfg.DBReplicaHealthInterval,
+				MaxLag:         cfg.DBReplicaMaxLag,
+			})
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to initialize read replicas")
+			}
+			defer db.CloseReplicas()
+			healthRegistry.Register("postgres_replicas", health.Degraded, 0, health.ReplicasChecker())
+		}
+
+		jobs.StartErasureJob(ctx, db.GetDB(), cfg.ErasureJobInterval, cfg.ErasureGracePeriod)
 	}
 
-	if config.REDIS_URL != "" {
-		err = db.InitRedis(ctx, config.REDIS_URL)
+	if cfg.RedisURL != "" {
+		err = db.InitRedis(ctx, cfg.RedisURL)
 		if err != nil {
-			log.Fatalf("Failed to initialize Redis: %v", err)
+			log.Fatal().Err(err).Msg("Failed to initialize Redis")
 		}
 		defer db.CloseRedis()
+		healthRegistry.Register("redis", health.Degraded, 0, health.RedisChecker())
 	}
 
-	if config.IS_PROD {
-		if config.SECRET_KEY == "" || config.SECRET_KEY == "qweasd123" || len(config.SECRET_KEY) < 32 {
-			log.Fatalf("SECRET_KEY must be set to a secure value (minimum 32 characters) in production")
-		}
+	// Startup safety checks enforced per APP_ENV profile
+	if err := cfg.CheckSafety(log); err != nil {
+		log.Fatal().Err(err).Msg("Refusing to start")
 	}
 
 	app := fiber.New(fiber.Config{
@@ -62,44 +129,65 @@ func main() {
 		IdleTimeout:       120 * time.Second,
 		ReadBufferSize:    4096,
 		WriteBufferSize:   4096,
-		EnablePrintRoutes: !config.IS_PROD,
+		EnablePrintRoutes: cfg.PrintRoutes,
 		Prefork:           false,
 		CaseSensitive:     false,
 		StrictRouting:     false,
 		ReduceMemoryUsage: true,
 		Network:           fiber.NetworkTCP,
-		BodyLimit:         int(config.REQUEST_BODY_LIMIT),
-		ErrorHandler:      errorHandler,
+		BodyLimit:         cfg.RequestBodyLimit(),
+		ErrorHandler:      newErrorHandler(cfg),
 	})
 
-	if !config.IS_PROD {
+	if cfg.NoStoreCache {
 		app.Use(func(c *fiber.Ctx) error {
 			c.Set("Cache-Control", "no-store")
 			return c.Next()
 		})
 	}
 
-	middlewares.SetupMiddlewares(app)
-	routes.SetupRoutes(app)
+	middlewares.SetupMiddlewares(app, cfg, reloader, log)
+	routes.SetupRoutes(app, cfg, healthRegistry)
 
-	port := config.PORT
-	if port == "" {
-		port = "3000"
+	metricsApp := setupMetrics(cfg, reloader)
+	if metricsApp != nil {
+		go func() {
+			if err := metricsApp.Listen(":" + cfg.MetricsPort); err != nil {
+				log.Fatal().Err(err).Msg("Failed to start metrics server")
+			}
+		}()
 	}
 
+	go reloader.Watch(ctx, cfg.ConfigWatchInterval)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
+	// Startup completes once the port accepts connections
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		healthRegistry.MarkStarted()
+		return nil
+	})
+
 	go func() {
-		if err := app.Listen(":" + port); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		if err := app.Listen(":" + cfg.Port); err != nil {
+			log.Fatal().Err(err).Msg("Failed to start server")
 		}
 	}()
 
 	<-quit
 
+	// Fail readiness first so load balancers stop routing while requests drain
+	healthRegistry.MarkStopping()
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	app.ShutdownWithContext(shutdownCtx)
+	if metricsApp != nil {
+		metricsApp.ShutdownWithContext(shutdownCtx)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/handlers"
+	"go-boilerplate-api/internal/api/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// setupMetrics registers the metrics owned by main and returns the app serving them on
+// METRICS_PORT, or nil when they are served on the main port or disabled
+func setupMetrics(cfg *config.Config, reloader *config.Reloader) *fiber.App {
+	if !cfg.MetricsEnabled {
+		return nil
+	}
+
+	metrics.RegisterGaugeFunc("websocket_connected_clients", "Connected WebSocket clients.", func() float64 {
+		return float64(handlers.GetConnectedClientsCount())
+	})
+	metrics.RegisterCounterFunc("config_reloads_total", "Configuration reloads by result.", prometheus.Labels{"result": "success"}, func() float64 {
+		return float64(reloader.Stats().Succeeded)
+	})
+	metrics.RegisterCounterFunc("config_reloads_total", "Configuration reloads by result.", prometheus.Labels{"result": "failure"}, func() float64 {
+		return float64(reloader.Stats().Failed)
+	})
+
+	if cfg.MetricsPort == "" {
+		return nil
+	}
+
+	metricsApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+	metricsApp.Get(cfg.MetricsPath, metrics.Handler())
+	return metricsApp
+}
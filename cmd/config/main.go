@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/logger"
+)
+
+func main() {
+	// The configuration is what this command prints, so it cannot configure the logger
+	log := logger.New(logger.Options{})
+
+	if len(os.Args) < 2 || os.Args[1] != "print" {
+		log.Fatal().Msg("Invalid command. Use: print [--redacted] [--<setting> value ...]")
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	redacted := fs.Bool("redacted", false, "Hide values of secret settings")
+
+	cfg, err := config.LoadWithOptions(config.Options{
+		Args:    os.Args[2:],
+		FlagSet: fs,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+	for _, s := range cfg.Settings(*redacted) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Value, s.Source)
+	}
+	w.Flush()
+}
@@ -3,79 +3,460 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"go-boilerplate-api/internal/api/config"
 	"go-boilerplate-api/internal/api/db"
+	_ "go-boilerplate-api/internal/api/db/datamigrations" // Registers the Go data migrations
+	"go-boilerplate-api/internal/api/logger"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/rs/zerolog"
 )
 
+const usage = `Usage: migrate [flags] <command> [argument]
+
+Commands:
+  up          Apply all pending migrations
+  down [N]    Revert the last N migrations (default 1)
+  steps N     Apply the next N migrations, or revert the last -N
+  goto V      Migrate up or down to version V
+  force V     Set the version to V and clear the dirty flag without running migrations
+              (-1 for no version). Use it after repairing a failed migration by hand.
+  drop        Drop every table of the database (requires -confirm)
+  status      List every migration with its applied or pending state
+  plan [up [N]|down [N]]
+              Print the SQL of the pending up migrations (or the next N), or of the last N
+              down migrations (default 1). With -execute, also apply them in a transaction
+              that is always rolled back.
+  version     Print the current version
+  validate    Fail if the database is in a dirty state
+  create      Create paired up/down files for the next version (requires -name)
+  lint        Flag risky operations in the embedded migrations, exit 1 on findings
+  diff        Compare the GORM models with the database schema, exit 1 on differences.
+              With -name, also create a draft migration resolving them.
+
+The command can also be given with -command, e.g. -command down 2. Flags must come before
+the command, and negative arguments need -- in that form: -command steps -- -2.
+
+Flags:
+`
+
 func main() {
 	var (
-		command     = flag.String("command", "", "Migration command: up, version, validate, create")
-		name        = flag.String("name", "", "Migration name (required for create command)")
+		command     = flag.String("command", "", "Migration command: up, down, steps, goto, force, drop, status, plan, version, validate, create, lint, diff")
+		name        = flag.String("name", "", "Migration name (required for create command, draft migration of diff)")
 		databaseURL = flag.String("database-url", "", "Database URL (overrides DATABASE_URL env var)")
+		confirm     = flag.Bool("confirm", false, "Confirm destructive commands (required for drop)")
+		execute     = flag.Bool("execute", false, "Dry run the plan in a transaction that is rolled back")
+		format      = flag.String("format", db.VersionSequential, "Version format of new migrations: seq or timestamp")
+		description = flag.String("description", "", "Description written to the header of new migrations")
+		dir         = flag.String("dir", db.MigrationsDir, "Migrations source directory used by create and diff")
 	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	// Load configuration
-	if err := config.LoadEnvFile(); err != nil {
-		log.Printf("Warning: Failed to load .env file: %v", err)
+	args := flag.Args()
+	if *command == "" && len(args) > 0 {
+		*command, args = args[0], args[1:]
+	}
+	if *command == "" {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	if err := config.LoadAllConfig(); err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		bootLog := logger.New(logger.Options{})
+		bootLog.Fatal().Err(err).Msg("Failed to load config")
 	}
 
+	// Every line of a migration run matters, so the logger is not sampled
+	log := logger.Init(logger.Options{Level: cfg.LogLevel.ZerologLevel(), Format: cfg.LogFormat})
+
 	// Use provided database URL or from config
 	dbURL := *databaseURL
 	if dbURL == "" {
-		dbURL = config.DATABASE_URL
+		dbURL = cfg.DatabaseURL
 	}
 
-	if dbURL == "" {
-		log.Fatalf("Database URL is required. Set DATABASE_URL environment variable or use -database-url flag")
+	if dbURL == "" && *command != "create" && *command != "lint" {
+		log.Fatal().Msg("Database URL is required. Set DATABASE_URL environment variable or use -database-url flag")
 	}
 
-	ctx := context.Background()
+	// Ctrl+C stops after the migration in progress instead of leaving the database dirty
+	ctx, stop := signal.NotifyContext(log.WithContext(context.Background()), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Every command connecting to the database shares one pool
+	if dbURL != "" && *command != "create" && *command != "lint" {
+		err := db.InitPool(ctx, dbURL, db.PoolOptions{
+			MaxConns:           int32(cfg.DBMaxConns),
+			ConnectTimeout:     cfg.DBConnectTimeout,
+			ApplicationName:    cfg.DBApplicationName + "-migrate",
+			StatementCacheMode: cfg.DBStatementCacheMode,
+			PgBouncer:          cfg.DBPgBouncer,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to connect to database")
+		}
+		defer db.ClosePool()
+	}
 
+	// Commands running data migrations hold the lock MIGRATE_ON_STARTUP=apply takes, so they
+	// never run alongside a starting instance or another cmd/migrate
 	switch *command {
 	case "up":
-		log.Println("Running migrations UP...")
-		if err := db.RunMigrations(ctx, dbURL); err != nil {
-			log.Fatalf("Migration failed: %v", err)
+		log.Info().Msg("Running migrations up")
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.RunMigrations(ctx, dbURL)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
+		}
+		log.Info().Msg("Migrations completed successfully")
+		printVersion(ctx, dbURL)
+
+	case "down":
+		n := 1
+		if len(args) > 0 {
+			n = positiveArg(log, args, "down")
+		}
+		log.Info().Int("n", n).Msg("Reverting migrations")
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.MigrateSteps(ctx, dbURL, -n)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
 		}
-		log.Println("Migrations completed successfully")
+		printVersion(ctx, dbURL)
+
+	case "steps":
+		n := intArg(log, args, "steps", "N")
+		if n == 0 {
+			log.Fatal().Msg("steps requires a non-zero N")
+		}
+		log.Info().Int("steps", n).Msg("Migrating")
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.MigrateSteps(ctx, dbURL, n)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
+		}
+		printVersion(ctx, dbURL)
+
+	case "goto":
+		version := positiveArg(log, args, "goto")
+		log.Info().Int("version", version).Msg("Migrating to version")
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.MigrateTo(ctx, dbURL, uint(version))
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
+		}
+		printVersion(ctx, dbURL)
+
+	case "force":
+		version := intArg(log, args, "force", "V")
+		if version < -1 {
+			log.Fatal().Msg("force requires a version >= -1")
+		}
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.ForceMigrationVersion(ctx, dbURL, version)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Force failed")
+		}
+		log.Info().Int("version", version).Msg("Version forced, dirty flag cleared")
+
+	case "drop":
+		if !*confirm {
+			log.Fatal().Msg("drop deletes every table and its data. Re-run with -confirm to proceed")
+		}
+		log.Info().Msg("Dropping every table")
+		err := db.WithMigrationLock(ctx, dbURL, cfg.MigrateLockTimeout, func() error {
+			return db.DropDatabase(ctx, dbURL)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Drop failed")
+		}
+		log.Info().Msg("Database dropped")
+
+	case "status":
+		printStatus(ctx, dbURL)
+
+	case "plan":
+		direction, n := db.DirectionUp, 0
+		if len(args) > 0 {
+			direction, args = args[0], args[1:]
+		}
+		if len(args) > 0 {
+			n = positiveArg(log, args, "plan "+direction)
+		}
+		printPlan(ctx, dbURL, direction, n, *execute)
 
 	case "version":
 		version, dirty, err := db.GetMigrationVersion(ctx, dbURL)
 		if err != nil {
-			log.Fatalf("Failed to get migration version: %v", err)
+			log.Fatal().Err(err).Msg("Failed to get migration version")
 		}
 		if dirty {
-			log.Printf("Current migration version: %d (DIRTY - manual intervention required)", version)
+			log.Error().Uint("version", version).Msg("Database is DIRTY: " + db.DirtyHint(version))
 			os.Exit(1)
 		} else {
-			log.Printf("Current migration version: %d", version)
+			log.Info().Uint("version", version).Msg("Current migration version")
 		}
 
 	case "validate":
 		if err := db.ValidateMigrations(ctx, dbURL); err != nil {
-			log.Fatalf("Migration validation failed: %v", err)
+			log.Fatal().Err(err).Msg("Migration validation failed")
 		}
-		log.Println("Migrations are valid")
+		log.Info().Msg("Migrations are valid")
 
 	case "create":
 		if *name == "" {
-			log.Fatal("Migration name is required. Use -name flag")
+			log.Fatal().Msg("Migration name is required. Use -name flag")
+		}
+		paths, err := db.CreateMigration(*dir, *name, db.CreateMigrationOptions{
+			Format:      *format,
+			Description: *description,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create migration")
+		}
+		for _, path := range paths {
+			log.Info().Str("file", path).Msg("Created migration")
 		}
-		log.Printf("Creating migration files: %s", *name)
-		// Note: For creating migration files, you may want to use migrate CLI tool:
-		// migrate create -ext sql -dir internal/api/db/migrations -seq <name>
-		log.Println("Use 'migrate create -ext sql -dir internal/api/db/migrations -seq <name>' to create migration files")
-		log.Println("Or manually create <version>_<name>.up.sql and <version>_<name>.down.sql files")
+
+	case "lint":
+		lint(log)
+
+	case "diff":
+		diff(ctx, dbURL, *name, *dir, *format, *description)
 
 	default:
-		log.Fatal("Invalid command. Use: up, version, validate, or create")
+		log.Fatal().Msg("Invalid command. Use: up, down, steps, goto, force, drop, status, plan, version, validate, create, lint, or diff")
+	}
+}
+
+// intArg parses the single integer argument of command
+func intArg(log zerolog.Logger, args []string, command, placeholder string) int {
+	if len(args) != 1 {
+		log.Fatal().Msgf("%s requires one argument: %s %s", command, command, placeholder)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		log.Fatal().Msgf("Invalid %s argument %q: expected an integer", command, args[0])
+	}
+	return n
+}
+
+// positiveArg parses the single positive integer argument of command
+func positiveArg(log zerolog.Logger, args []string, command string) int {
+	n := intArg(log, args, command, "N")
+	if n < 1 {
+		log.Fatal().Msgf("%s requires a positive number", command)
+	}
+	return n
+}
+
+func printVersion(ctx context.Context, dbURL string) {
+	log := zerolog.Ctx(ctx)
+	version, dirty, err := db.GetMigrationVersion(ctx, dbURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get migration version")
+	}
+	log.Info().Uint("version", version).Bool("dirty", dirty).Msg("Current migration version")
+}
+
+func printStatus(ctx context.Context, dbURL string) {
+	log := zerolog.Ctx(ctx)
+	states, err := db.MigrationStatus(ctx, dbURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get migration status")
+	}
+
+	dataStates, err := db.DataMigrationStatus(ctx, dbURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get data migration status")
+	}
+	dataByVersion := map[uint][]db.DataMigrationState{}
+	for _, state := range dataStates {
+		dataByVersion[state.After] = append(dataByVersion[state.After], state)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+	pending := 0
+	printData := func(version uint) {
+		for _, state := range dataByVersion[version] {
+			status := "pending"
+			switch {
+			case state.CompletedAt != nil:
+				status = fmt.Sprintf("applied (%d rows)", state.RowsDone)
+			case state.StartedAt != nil:
+				status = fmt.Sprintf("in progress (%d rows)", state.RowsDone)
+				pending++
+			default:
+				pending++
+			}
+			fmt.Fprintf(w, "%06d\t%s (go)\t%s\n", state.After, state.Name, status)
+		}
+	}
+	printData(0)
+	for _, state := range states {
+		status := "pending"
+		switch {
+		case state.Dirty:
+			status = "dirty"
+		case state.Applied:
+			status = "applied"
+		default:
+			pending++
+		}
+		if !state.HasDown {
+			status += " (no down migration)"
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\n", state.Version, state.Name, status)
+		printData(state.Version)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d migration(s), %d pending\n", len(states)+len(dataStates), pending)
+
+	version, _, err := db.GetMigrationVersion(ctx, dbURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get migration version")
+	}
+	if len(states) > 0 && version > states[len(states)-1].Version {
+		fmt.Printf("WARNING: the database is at version %d, newer than the migrations of this binary\n", version)
+	}
+}
+
+// printPlan prints the migrations that would run and, with execute, dry runs them
+func printPlan(ctx context.Context, dbURL, direction string, n int, execute bool) {
+	log := zerolog.Ctx(ctx)
+	plan, err := db.PlanMigrations(ctx, dbURL, direction, n)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to plan migrations")
+	}
+
+	fmt.Printf("Current version: %d\n", plan.Current)
+	if len(plan.Steps) == 0 {
+		fmt.Printf("Nothing to migrate %s\n", direction)
+		return
+	}
+	fmt.Printf("Plan: %d migration(s) %s\n", len(plan.Steps), direction)
+	for _, step := range plan.Steps {
+		if step.Data != nil {
+			fmt.Printf("\n=== data migration %s (Go, after version %d) ===\n", step.Name, step.Version)
+			continue
+		}
+		fmt.Printf("\n=== %s ===\n%s", step.File, step.SQL)
+		if !strings.HasSuffix(step.SQL, "\n") {
+			fmt.Println()
+		}
+	}
+
+	if !execute {
+		return
+	}
+
+	fmt.Println("\nDry run: applying the plan in a transaction that will be rolled back...")
+	results, err := db.DryRunPlan(ctx, dbURL, plan)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Dry run failed")
+	}
+	failed := false
+	for _, result := range results {
+		switch {
+		case result.Skipped && result.Step.Data != nil:
+			fmt.Printf("  SKIP data migration %s (Go data migrations do not run in a dry run)\n", result.Step.Name)
+		case result.Skipped && result.Step.TransactionControl:
+			fmt.Printf("  SKIP %s (has its own BEGIN, COMMIT or ROLLBACK, which would end the dry run)\n", result.Step.File)
+		case result.Skipped:
+			fmt.Printf("  SKIP %s (cannot run inside a transaction)\n", result.Step.File)
+		case result.Err != nil:
+			fmt.Printf("  FAIL %s: %v\n", result.Step.File, result.Err)
+			failed = true
+		default:
+			fmt.Printf("  OK   %s (%s)\n", result.Step.File, result.Duration.Round(time.Millisecond))
+		}
+	}
+	if failed {
+		fmt.Println("Dry run failed, the transaction was rolled back")
+		os.Exit(1)
+	}
+	fmt.Println("Dry run succeeded, the transaction was rolled back")
+}
+
+// lint prints the findings of the embedded migrations and exits 1 when there are any
+func lint(log zerolog.Logger) {
+	findings, err := db.LintEmbeddedMigrations()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to lint migrations")
+	}
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	if len(findings) > 0 {
+		fmt.Printf("\n%d finding(s). Fix them, or suppress one with a justified comment:\n"+
+			"  -- lint:ignore <rule> <reason>       (line before the statement)\n"+
+			"  -- lint:ignore-file <rule> <reason>  (whole file)\n", len(findings))
+		os.Exit(1)
+	}
+	log.Info().Msg("No risky operations found")
+}
+
+// diff prints the differences between the models and the database and exits 1 when there are
+// any. With name, it writes them as a draft migration to review.
+func diff(ctx context.Context, dbURL, name, dir, format, description string) {
+	log := zerolog.Ctx(ctx)
+	diffs, err := db.DiffSchema(ctx, dbURL, models.All())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to compare the models with the database")
+	}
+	if len(diffs) == 0 {
+		log.Info().Msg("The database schema matches the models")
+		return
+	}
+
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	fmt.Printf("\n%d difference(s)\n", len(diffs))
+
+	if name == "" {
+		fmt.Println("Re-run with -name to create a draft migration resolving them")
+		os.Exit(1)
+	}
+	if description == "" {
+		description = "Align the schema with the GORM models (generated by migrate diff, review before applying)"
+	}
+	up, down := db.DraftMigration(diffs)
+	paths, err := db.CreateMigration(dir, name, db.CreateMigrationOptions{
+		Format:      format,
+		Description: description,
+		UpSQL:       up,
+		DownSQL:     down,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create migration")
+	}
+	for _, path := range paths {
+		log.Info().Str("file", path).Msg("Created draft migration")
 	}
+	log.Warn().Msg("Review the draft: fill in the Safety header, move CONCURRENTLY indexes to their own migration, then run lint")
+	os.Exit(1)
 }
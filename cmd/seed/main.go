@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/internal/api/logger"
+	"go-boilerplate-api/internal/api/seed"
+)
+
+const usage = `Usage: seed [flags]
+
+Upserts the users of seeds/<profile>.{yaml,yml,json} (dev, demo, test, ...). Running it again
+updates the same rows and skips those already matching. It refuses to run in production unless
+-force is given.
+
+Flags:
+`
+
+func main() {
+	os.Exit(run())
+}
+
+// run seeds the database and returns the exit code, so deferred cleanups run before exiting
+func run() int {
+	var (
+		profile     = flag.String("profile", "dev", "Fixture profile, the name of a file in -dir")
+		dir         = flag.String("dir", seed.DefaultDir, "Fixtures directory")
+		file        = flag.String("file", "", "Fixture file to load instead of -profile")
+		databaseURL = flag.String("database-url", "", "Database URL (overrides DATABASE_URL env var)")
+		force       = flag.Bool("force", false, "Seed even when APP_ENV is production or IS_PROD is true")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		bootLog := logger.New(logger.Options{})
+		bootLog.Error().Err(err).Msg("Failed to load config")
+		return 1
+	}
+
+	// Every line of a run matters, so the logger is not sampled
+	log := logger.Init(logger.Options{Level: cfg.LogLevel.ZerologLevel(), Format: cfg.LogFormat})
+
+	if cfg.AppEnv == "production" || cfg.IsProd {
+		if !*force {
+			log.Error().Msg("Refusing to seed a production database (APP_ENV=production or IS_PROD=true). Re-run with -force if you are sure")
+			return 1
+		}
+		log.Warn().Msg("Seeding a production database because -force was given")
+	}
+
+	path := *file
+	if path == "" {
+		path, err = seed.FindFile(*dir, *profile)
+		if err != nil {
+			log.Error().Err(err).Msg("Fixtures not found")
+			return 1
+		}
+	}
+	fixtures, err := seed.Load(path)
+	if err != nil {
+		log.Error().Err(err).Str("file", path).Msg("Invalid fixtures")
+		return 1
+	}
+
+	// Use provided database URL or from config
+	dbURL := *databaseURL
+	if dbURL == "" {
+		dbURL = cfg.DatabaseURL
+	}
+	if dbURL == "" {
+		log.Error().Msg("Database URL is required. Set DATABASE_URL environment variable or use -database-url flag")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(log.WithContext(context.Background()), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = db.InitPostgres(ctx, dbURL, db.PoolOptions{
+		MaxConns:           int32(cfg.DBMaxConns),
+		ConnectTimeout:     cfg.DBConnectTimeout,
+		ApplicationName:    cfg.DBApplicationName + "-seed",
+		StatementCacheMode: cfg.DBStatementCacheMode,
+		PgBouncer:          cfg.DBPgBouncer,
+	}, db.QueryLogOptions{SlowThreshold: cfg.DBSlowQueryThreshold})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to connect to database")
+		return 1
+	}
+	defer db.ClosePostgres()
+
+	result, err := seed.Apply(ctx, db.GetDB(), fixtures)
+	if err != nil {
+		log.Error().Err(err).Msg("Seeding failed, nothing was written")
+		return 1
+	}
+	log.Info().Str("file", path).
+		Int("created", result.Created).
+		Int("updated", result.Updated).
+		Int("unchanged", result.Unchanged).
+		Msg("Seeded users")
+	return 0
+}
@@ -1,103 +1,290 @@
 package config
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
-func LoadAllConfig() error {
-	// Load env file
-	err := LoadEnvFile()
-	if err != nil {
-		return err
-	}
+// Config holds the application configuration.
+//
+// Every field is resolved from the variable named by its env tag through these
+// layers, each overriding the previous one:
+//
+//	defaults (default tag) < APP_ENV profile < config file < environment < <NAME>_FILE secrets < flags
+//
+// The config file is config/<APP_ENV>.{yaml,yml,toml} unless CONFIG_FILE is set.
+// The result is checked against the validate tag (go-playground/validator syntax).
+// Fields tagged reload can be changed at runtime through a Reloader.
+type Config struct {
+	AppEnv     string `env:"APP_ENV" default:"development" validate:"required,oneof=development test staging production"`
+	ConfigFile string `env:"CONFIG_FILE"`
+
+	Port string `env:"PORT" default:"8080" validate:"required,numeric"`
+	// IsProd is true when APP_ENV is production. Deprecated: setting IS_PROD=true without
+	// APP_ENV selects the production profile; use APP_ENV and the feature toggles instead.
+	IsProd    bool   `env:"IS_PROD" default:"false"`
+	Timezone  string `env:"TIMEZONE" default:"Asia/Manila" validate:"required,timezone"`
+	SecretKey string `env:"SECRET_KEY" default:"qweasd123" validate:"required" secret:"true"`
+
+	LogLevel  LOG_LEVEL_TYPE `env:"LOG_LEVEL" default:"debug" reload:"true"`
+	LogFormat string         `env:"LOG_FORMAT" default:"json" validate:"oneof=json console"`
+	// LogSampleEvery keeps one of every N debug and info log events, 1 keeps all of them
+	LogSampleEvery int `env:"LOG_SAMPLE_EVERY" default:"1" validate:"min=1"`
+
+	// Comma-separated redaction rules added to the defaults, see logger.RedactionRules
+	LogRedactHeaders string `env:"LOG_REDACT_HEADERS"`
+	LogRedactFields  string `env:"LOG_REDACT_FIELDS"`
+	LogRedactPaths   string `env:"LOG_REDACT_PATHS"`
+	// LogHeaders and LogBodies add the redacted request headers and bodies to the access log
+	LogHeaders      bool `env:"LOG_HEADERS" default:"false"`
+	LogBodies       bool `env:"LOG_BODIES" default:"false"`
+	LogBodyMaxBytes int  `env:"LOG_BODY_MAX_BYTES" default:"2048" validate:"min=1"`
+
+	TokenTTL         time.Duration `env:"TOKEN_EXPIRE_TIME" default:"5h" validate:"gt=0"`
+	ImpersonationTTL time.Duration `env:"IMPERSONATION_TTL" default:"15m" validate:"gt=0"`
+
+	AllowedOrigins     string `env:"ALLOWED_ORIGINS" reload:"true"`
+	RequestBodyLimitMB int    `env:"REQUEST_BODY_LIMIT_MB" default:"50" validate:"min=1"`
+
+	RateLimitMax    int           `env:"RATE_LIMIT_MAX" default:"100" validate:"min=1" reload:"true"`
+	RateLimitWindow time.Duration `env:"RATE_LIMIT_WINDOW" default:"1m" validate:"gt=0" reload:"true"`
+
+	// ConfigWatchInterval is how often the config file is checked for changes, 0 disables it
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" default:"5s"`
+
+	DatabaseURL  string        `env:"DATABASE_URL" validate:"omitempty,url" secret:"true"`
+	RedisURL     string        `env:"REDIS_URL" validate:"omitempty,url" secret:"true"`
+	RedisKeysTTL time.Duration `env:"REDIS_KEYS_TTL" default:"168h" validate:"gt=0"`
+
+	S3BucketName string `env:"S3BUCKETNAME" default:"testbucket"`
+
+	// Feature toggles, defaulted per APP_ENV profile
+	StackTraces  bool `env:"STACK_TRACES" default:"false"`
+	StrictCORS   bool `env:"STRICT_CORS" default:"true"`
+	PrintRoutes  bool `env:"PRINT_ROUTES" default:"false"`
+	NoStoreCache bool `env:"NO_STORE_CACHE" default:"false"`
+	MaskErrors   bool `env:"MASK_ERRORS" default:"true"`
+	LogEmails    bool `env:"LOG_EMAILS" default:"false"`
+
+	// Metrics are served on METRICS_PATH of the main port, or of METRICS_PORT when set. They
+	// are unauthenticated, so outside development keep them off the public port.
+	MetricsEnabled bool   `env:"METRICS_ENABLED" default:"false"`
+	MetricsPath    string `env:"METRICS_PATH" default:"/metrics" validate:"required,startswith=/"`
+	MetricsPort    string `env:"METRICS_PORT" validate:"omitempty,numeric"`
+
+	// SQL logging: queries slower than DB_SLOW_QUERY_THRESHOLD are logged as warnings, parameter
+	// values are only logged with DB_LOG_PARAMS, and DB_N_PLUS_ONE_THRESHOLD runs of one statement
+	// in a request are reported as a possible N+1. DB_QUERY_STATS_HEADER adds X-Query-Count and
+	// X-Query-Duration to responses.
+	DBSlowQueryThreshold time.Duration `env:"DB_SLOW_QUERY_THRESHOLD" default:"200ms" validate:"min=0"`
+	DBLogParams          bool          `env:"DB_LOG_PARAMS" default:"false"`
+	DBNPlusOneThreshold  int           `env:"DB_N_PLUS_ONE_THRESHOLD" default:"10" validate:"min=0"`
+	DBQueryStatsHeader   bool          `env:"DB_QUERY_STATS_HEADER" default:"false"`
+
+	// Connection pool shared by GORM, the migrations and raw pgx queries. DB_MAX_CONNS must leave
+	// room for the 3 connections an instance holds while migrating on startup.
+	// DB_STATEMENT_CACHE_MODE is prepare (cache prepared statements), describe (cache result
+	// descriptions only) or none. DB_PGBOUNCER uses the simple protocol without prepared
+	// statements, as PgBouncer requires in transaction pooling mode.
+	DBMaxConns           int           `env:"DB_MAX_CONNS" default:"100" validate:"min=3"`
+	DBMinConns           int           `env:"DB_MIN_CONNS" default:"0" validate:"min=0,ltefield=DBMaxConns"`
+	DBMaxConnLifetime    time.Duration `env:"DB_MAX_CONN_LIFETIME" default:"1h" validate:"gt=0"`
+	DBMaxConnIdleTime    time.Duration `env:"DB_MAX_CONN_IDLE_TIME" default:"30m" validate:"gt=0"`
+	DBConnectTimeout     time.Duration `env:"DB_CONNECT_TIMEOUT" default:"5s" validate:"gt=0"`
+	DBApplicationName    string        `env:"DB_APPLICATION_NAME" default:"go-boilerplate-api" validate:"max=63"`
+	DBStatementCacheMode string        `env:"DB_STATEMENT_CACHE_MODE" default:"prepare" validate:"oneof=prepare describe none"`
+	DBPgBouncer          bool          `env:"DB_PGBOUNCER" default:"false"`
+
+	// Read replicas, comma separated. Reads go to the healthy ones and writes, transactions and
+	// reads within DB_REPLICA_STICKY_WINDOW of a write by the same user go to DATABASE_URL.
+	// Replicas lagging more than DB_REPLICA_MAX_LAG (0 for no limit) are unhealthy.
+	DatabaseReplicaURLs     string        `env:"DATABASE_REPLICA_URLS" secret:"true"`
+	DBReplicaStickyWindow   time.Duration `env:"DB_REPLICA_STICKY_WINDOW" default:"5s" validate:"min=0"`
+	DBReplicaHealthInterval time.Duration `env:"DB_REPLICA_HEALTH_INTERVAL" default:"5s" validate:"gt=0"`
+	DBReplicaMaxLag         time.Duration `env:"DB_REPLICA_MAX_LAG" default:"10s" validate:"min=0"`
+
+	// MigrateOnStartup applies pending migrations (apply), only checks the schema version is the
+	// one this build expects (verify) or skips both (off). Instances applying concurrently take
+	// turns on an advisory lock, waiting at most MIGRATE_LOCK_TIMEOUT.
+	MigrateOnStartup   string        `env:"MIGRATE_ON_STARTUP" default:"apply" validate:"oneof=off apply verify"`
+	MigrateLockTimeout time.Duration `env:"MIGRATE_LOCK_TIMEOUT" default:"5m" validate:"gt=0"`
+
+	// Health probe results are cached so frequent probes do not ping the dependencies each time
+	HealthCacheTTL     time.Duration `env:"HEALTH_CACHE_TTL" default:"1s" validate:"min=0"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" default:"2s" validate:"gt=0"`
+
+	// Tracing exports spans to stdout or an OTLP/HTTP collector. With none, incoming
+	// traceparent headers are still propagated to request IDs and logs.
+	TracingExporter     string  `env:"TRACING_EXPORTER" default:"none" validate:"oneof=none stdout otlp"`
+	TracingServiceName  string  `env:"TRACING_SERVICE_NAME" default:"go-boilerplate-api" validate:"required"`
+	TracingSampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+	TracingOTLPEndpoint string  `env:"TRACING_OTLP_ENDPOINT" validate:"omitempty,url"`
+
+	ErasureGracePeriod time.Duration `env:"ERASURE_GRACE_PERIOD" default:"720h" validate:"gt=0"`
+	ErasureJobInterval time.Duration `env:"ERASURE_JOB_INTERVAL" default:"1h" validate:"gt=0"`
+
+	// sources records where each variable was resolved from
+	sources map[string]string
+}
+
+// Options controls how LoadWithOptions reads the configuration
+type Options struct {
+	// Args are parsed as config flags, e.g. --port 9000 or --database-url=...
+	Args []string
+	// FlagSet receives the config flags. Callers may register their own flags on it
+	// beforehand. A new flag set is used when nil.
+	FlagSet *flag.FlagSet
+}
+
+// Setting is the effective value of a variable and the layer it came from
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// RequestBodyLimit returns the request body limit in bytes
+func (c *Config) RequestBodyLimit() int {
+	return c.RequestBodyLimitMB * 1024 * 1024
+}
 
-	LOG_LEVEL, err = determineLogLevel(os.Getenv("LOG_LEVEL"))
-	if err != nil {
-		return err
+// ReplicaURLs returns the read replica URLs of DATABASE_REPLICA_URLS
+func (c *Config) ReplicaURLs() []string {
+	var urls []string
+	for _, url := range strings.Split(c.DatabaseReplicaURLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
 	}
+	return urls
+}
 
-	PORT = os.Getenv("PORT")
-	IS_PROD = os.Getenv("IS_PROD") == "true"
+// Load reads the .env file, if any, and builds the configuration without command-line flags.
+// All invalid variables are reported together in the returned error.
+func Load() (*Config, error) {
+	return LoadWithOptions(Options{})
+}
 
-	SECRET_KEY = os.Getenv("SECRET_KEY")
-	if SECRET_KEY == "" {
-		SECRET_KEY = "qweasd123"
+// LoadWithOptions reads the .env file, if any, and builds the configuration from all layers
+func LoadWithOptions(opts Options) (*Config, error) {
+	if err := LoadEnvFile(); err != nil {
+		return nil, err
 	}
 
-	expireRaw := os.Getenv("TOKEN_EXPIRE_TIME")
-	if expireRaw != "" {
-		TOKEN_TTL, err = time.ParseDuration(expireRaw)
-		if err != nil {
-			return fmt.Errorf("error parsing token expire time duration, %w", err)
+	flags := map[string]string{}
+	if opts.Args != nil {
+		fs := opts.FlagSet
+		if fs == nil {
+			fs = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+		}
+		registerFlags(fs)
+		if err := fs.Parse(opts.Args); err != nil {
+			return nil, err
+		}
+
+		names := map[string]string{}
+		for _, field := range configFields() {
+			names[flagName(field.name)] = field.name
 		}
-	} else {
-		TOKEN_TTL = time.Hour * 5
+		fs.Visit(func(f *flag.Flag) {
+			if name, ok := names[f.Name]; ok {
+				flags[name] = f.Value.String()
+			}
+		})
 	}
 
-	ALLOWED_ORIGINS = os.Getenv("ALLOWED_ORIGINS")
+	cfg := &Config{}
+	if err := load(cfg, os.LookupEnv, flags); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
 
-	REDIS_KEYS_TTL, err = time.ParseDuration(os.Getenv("REDIS_KEYS_TTL"))
-	if err != nil {
-		REDIS_KEYS_TTL = time.Hour * 24 * 7
+// Settings returns the effective value and source of every variable.
+// Fields tagged secret are replaced with [REDACTED] when redact is true.
+func (c *Config) Settings(redact bool) []Setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	settings := make([]Setting, 0, t.NumField())
+	for _, field := range configFields() {
+		value := fmt.Sprint(v.Field(field.index).Interface())
+		if redact && t.Field(field.index).Tag.Get("secret") == "true" && value != "" {
+			value = "[REDACTED]"
+		}
+		settings = append(settings, Setting{
+			Name:   field.name,
+			Value:  value,
+			Source: c.sources[field.name],
+		})
 	}
 
-	DATABASE_URL = os.Getenv("DATABASE_URL")
-	REDIS_URL = os.Getenv("REDIS_URL")
+	return settings
+}
+
+// envFileKeys are the variables the .env file set in the process environment. A later load,
+// such as a reload, overrides them with the current content of the file.
+var (
+	envFileMu   sync.Mutex
+	envFileKeys = map[string]bool{}
+)
 
-	timezone := os.Getenv("TIMEZONE")
-	if timezone != "" {
-		TIMEZONE = timezone
+// LoadEnvFile reads the .env file of the working directory, or else of the binary's directory,
+// into the process environment. Variables set outside the file are never overridden, those
+// set by an earlier call follow the file, and are unset once removed from it.
+func LoadEnvFile() error {
+	values := map[string]string{}
+	if path := envFilePath(); path != "" {
+		var err error
+		if values, err = godotenv.Read(path); err != nil {
+			return err
+		}
 	}
 
-	bodyLimitStr := os.Getenv("REQUEST_BODY_LIMIT_MB")
-	if bodyLimitStr != "" {
-		var bodyLimitMB int
-		_, err := fmt.Sscanf(bodyLimitStr, "%d", &bodyLimitMB)
-		if err == nil && bodyLimitMB > 0 {
-			REQUEST_BODY_LIMIT = bodyLimitMB * 1024 * 1024
+	envFileMu.Lock()
+	defer envFileMu.Unlock()
+
+	for key := range envFileKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(envFileKeys, key)
 		}
 	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !envFileKeys[key] {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+		envFileKeys[key] = true
+	}
 
 	return nil
 }
 
-func LoadEnvFile() error {
+// envFilePath returns the .env file in use, "" when there is none
+func envFilePath() string {
 	if _, err := os.Stat(".env"); !os.IsNotExist(err) {
-		return godotenv.Load(".env")
+		return ".env"
 	}
 
 	exePath, err := os.Executable()
 	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		envPath := filepath.Join(exeDir, ".env")
+		envPath := filepath.Join(filepath.Dir(exePath), ".env")
 		if _, err := os.Stat(envPath); !os.IsNotExist(err) {
-			return godotenv.Load(envPath)
+			return envPath
 		}
 	}
 
-	return nil
-}
-
-func determineLogLevel(logLevel string) (LOG_LEVEL_TYPE, error) {
-	switch logLevel {
-	case "":
-		return LOG_LEVEL_DEBUG, nil
-	case "info":
-		return LOG_LEVEL_INFO, nil
-	case "warn":
-		return LOG_LEVEL_WARN, nil
-	case "debug":
-		return LOG_LEVEL_DEBUG, nil
-	case "error":
-		return LOG_LEVEL_ERROR, nil
-	case "fatal":
-		return LOG_LEVEL_FATAL, nil
-	default:
-		return LOG_LEVEL_NOTFOUND, fmt.Errorf("invalid log level")
-	}
+	return ""
 }
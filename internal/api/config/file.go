@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileExtensions are the supported config file formats, in lookup order
+var configFileExtensions = []string{".yaml", ".yml", ".toml"}
+
+// findConfigFile returns the config file to read. An explicit CONFIG_FILE must exist;
+// otherwise config/<APP_ENV>.{yaml,yml,toml} is looked up in the working directory
+// and next to the executable, and a missing file is not an error.
+func findConfigFile(appEnv, configFile string) (string, error) {
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return "", fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		return configFile, nil
+	}
+
+	if appEnv == "" {
+		return "", nil
+	}
+
+	dirs := []string{"config"}
+	if exePath, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Join(filepath.Dir(exePath), "config"))
+	}
+
+	for _, dir := range dirs {
+		for _, ext := range configFileExtensions {
+			path := filepath.Join(dir, appEnv+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// readConfigFile parses a flat YAML or TOML file into variable values keyed by
+// variable name. Keys are the lowercase variable names, e.g. database_url.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse config file: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: %q must be a single value", path, key)
+		case nil:
+			values[strings.ToUpper(key)] = ""
+		default:
+			values[strings.ToUpper(key)] = fmt.Sprint(value)
+		}
+	}
+
+	return values, nil
+}
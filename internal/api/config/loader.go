@@ -0,0 +1,337 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Sources a setting can come from, in increasing order of precedence
+const (
+	SourceDefault    = "default"
+	SourceProfile    = "profile"
+	SourceFile       = "file"
+	SourceEnv        = "env"
+	SourceSecretFile = "secret-file"
+	SourceFlag       = "flag"
+)
+
+// Errors lists every problem found while loading the configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, "  - "+err.Error())
+	}
+	return fmt.Sprintf("invalid configuration (%d problems):\n%s", len(e), strings.Join(messages, "\n"))
+}
+
+// setting is the raw value of a variable and where it came from
+type setting struct {
+	value  string
+	source string
+}
+
+// configField describes a Config field with an env tag
+type configField struct {
+	index int
+	name  string
+	def   string
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configFields returns the Config fields that are loaded from variables
+func configFields() []configField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		fields = append(fields, configField{index: i, name: name, def: field.Tag.Get("default")})
+	}
+	return fields
+}
+
+// flagName returns the command-line flag for a variable, e.g. DATABASE_URL -> database-url
+func flagName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+// registerFlags adds one string flag per variable to fs
+func registerFlags(fs *flag.FlagSet) {
+	for _, field := range configFields() {
+		if fs.Lookup(flagName(field.name)) != nil {
+			continue
+		}
+		fs.String(flagName(field.name), "", fmt.Sprintf("overrides %s", field.name))
+	}
+}
+
+// load resolves every variable through the configuration layers, then parses and validates cfg
+func load(cfg *Config, lookup func(string) (string, bool), flags map[string]string) error {
+	var problems Errors
+	fields := configFields()
+	values := make(map[string]setting, len(fields))
+
+	// Layer 1: defaults
+	for _, field := range fields {
+		values[field.name] = setting{value: field.def, source: SourceDefault}
+	}
+
+	// Bootstrap settings decide which config file is read, so they cannot come from it
+	appEnv := resolveBootstrap("APP_ENV", values, lookup, flags)
+	configFile := resolveBootstrap("CONFIG_FILE", values, lookup, flags)
+
+	// Deprecated IS_PROD=true without APP_ENV selects the production profile
+	if !bootstrapSet("APP_ENV", lookup, flags) {
+		if isProd, err := strconv.ParseBool(resolveBootstrap("IS_PROD", values, lookup, flags)); err == nil && isProd {
+			appEnv = EnvProduction
+			values["APP_ENV"] = setting{value: appEnv, source: SourceEnv + " IS_PROD"}
+		}
+	}
+
+	// Profile defaults for APP_ENV, an unknown APP_ENV is reported by validation
+	for name, value := range profileDefaults[appEnv] {
+		values[name] = setting{value: value, source: SourceProfile + " " + appEnv}
+	}
+
+	// Layer 2: config file selected by APP_ENV or CONFIG_FILE
+	path, err := findConfigFile(appEnv, configFile)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	if path != "" {
+		fileValues, err := readConfigFile(path)
+		if err != nil {
+			problems = append(problems, err)
+		}
+		for name, value := range fileValues {
+			if _, ok := values[name]; !ok {
+				problems = append(problems, fmt.Errorf("%s: unknown key %q", path, strings.ToLower(name)))
+				continue
+			}
+			if name == "APP_ENV" || name == "CONFIG_FILE" {
+				problems = append(problems, fmt.Errorf("%s: %q cannot be set in a config file", path, strings.ToLower(name)))
+				continue
+			}
+			values[name] = setting{value: value, source: SourceFile + " " + path}
+		}
+	}
+
+	for _, field := range fields {
+		// Layer 3: environment variables, empty values are treated as unset
+		envValue, hasEnv := lookup(field.name)
+		hasEnv = hasEnv && envValue != ""
+		if hasEnv {
+			values[field.name] = setting{value: envValue, source: SourceEnv}
+		}
+
+		// Layer 4: <NAME>_FILE pointing to a mounted secret
+		secretPath, hasSecret := lookup(field.name + "_FILE")
+		if hasSecret && secretPath != "" {
+			if hasEnv {
+				problems = append(problems, fmt.Errorf("%s: set either %s or %s_FILE, not both", field.name, field.name, field.name))
+				continue
+			}
+			content, err := os.ReadFile(secretPath)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s_FILE: %w", field.name, err))
+				continue
+			}
+			values[field.name] = setting{
+				value:  strings.TrimRight(string(content), "\r\n"),
+				source: SourceSecretFile + " " + secretPath,
+			}
+		}
+
+		// Layer 5: command-line flags
+		if flagValue, ok := flags[field.name]; ok {
+			values[field.name] = setting{value: flagValue, source: SourceFlag + " --" + flagName(field.name)}
+		}
+	}
+
+	unparsed := map[string]bool{}
+	cfg.sources = make(map[string]string, len(fields))
+
+	v := reflect.ValueOf(cfg).Elem()
+	for _, field := range fields {
+		s := values[field.name]
+		cfg.sources[field.name] = s.source
+		if err := setField(v.Field(field.index), s.value); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w (from %s)", field.name, err, s.source))
+			unparsed[field.name] = true
+		}
+	}
+
+	// IS_PROD is derived from APP_ENV, an explicit value must agree with it
+	if !unparsed["IS_PROD"] && cfg.IsProd != (cfg.AppEnv == EnvProduction) {
+		problems = append(problems, fmt.Errorf("IS_PROD: %v conflicts with APP_ENV=%s (from %s), set APP_ENV only", cfg.IsProd, cfg.AppEnv, values["IS_PROD"].source))
+	}
+
+	// Applying migrations takes session level advisory locks, which PgBouncer's transaction
+	// pooling does not keep
+	if !unparsed["DB_PGBOUNCER"] && cfg.DBPgBouncer && cfg.MigrateOnStartup == "apply" {
+		problems = append(problems, fmt.Errorf("MIGRATE_ON_STARTUP: apply (from %s) cannot lock through PgBouncer (DB_PGBOUNCER=true from %s), set verify and run cmd/migrate against a direct connection",
+			values["MIGRATE_ON_STARTUP"].source, values["DB_PGBOUNCER"].source))
+	}
+
+	// Variables that failed to parse are already reported
+	for _, err := range validateConfig(cfg) {
+		var fieldErr fieldError
+		if errors.As(err, &fieldErr) && unparsed[fieldErr.name] {
+			continue
+		}
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// resolveBootstrap resolves a setting needed before the config file is read (flag > env > default)
+func resolveBootstrap(name string, values map[string]setting, lookup func(string) (string, bool), flags map[string]string) string {
+	if value, ok := flags[name]; ok {
+		return value
+	}
+	if value, ok := lookup(name); ok && value != "" {
+		return value
+	}
+	return values[name].value
+}
+
+// bootstrapSet reports whether a bootstrap setting was given as an environment variable or flag
+func bootstrapSet(name string, lookup func(string) (string, bool), flags map[string]string) bool {
+	if _, ok := flags[name]; ok {
+		return true
+	}
+	value, ok := lookup(name)
+	return ok && value != ""
+}
+
+// setField parses raw into the field according to its type
+func setField(field reflect.Value, raw string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+
+	if raw == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (expected e.g. 30s, 5m, 24h)", raw)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (expected true or false)", raw)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+
+	return nil
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// Report problems using the environment variable name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("env")
+	})
+	return v
+}
+
+// validateConfig checks the validate struct tags and returns one error per failing variable
+func validateConfig(cfg *Config) Errors {
+	err := validate.Struct(cfg)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return Errors{err}
+	}
+
+	problems := make(Errors, 0, len(validationErrors))
+	for _, err := range validationErrors {
+		problems = append(problems, fieldError{name: err.Field(), message: describeValidation(err)})
+	}
+	return problems
+}
+
+// fieldError is a validation failure of a single variable
+type fieldError struct {
+	name    string
+	message string
+}
+
+func (e fieldError) Error() string {
+	return e.name + ": " + e.message
+}
+
+func describeValidation(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "numeric":
+		return "must be numeric"
+	case "url":
+		return "must be a valid URL"
+	case "timezone":
+		return "must be a valid IANA timezone"
+	case "min":
+		return fmt.Sprintf("must be at least %s", err.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", err.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", err.Param())
+	case "startswith":
+		return fmt.Sprintf("must start with %q", err.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", err.Param())
+	default:
+		return fmt.Sprintf("failed %q validation", err.Tag())
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+type LOG_LEVEL_TYPE int8
+
+const (
+	LOG_LEVEL_NOTFOUND LOG_LEVEL_TYPE = iota - 1
+	LOG_LEVEL_INFO
+	LOG_LEVEL_WARN
+	LOG_LEVEL_DEBUG
+	LOG_LEVEL_ERROR
+	LOG_LEVEL_FATAL
+)
+
+// String returns the LOG_LEVEL value of the level
+func (l LOG_LEVEL_TYPE) String() string {
+	switch l {
+	case LOG_LEVEL_INFO:
+		return "info"
+	case LOG_LEVEL_WARN:
+		return "warn"
+	case LOG_LEVEL_DEBUG:
+		return "debug"
+	case LOG_LEVEL_ERROR:
+		return "error"
+	case LOG_LEVEL_FATAL:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// UnmarshalText parses a LOG_LEVEL value
+func (l *LOG_LEVEL_TYPE) UnmarshalText(text []byte) error {
+	level, err := determineLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ZerologLevel returns the zerolog level logging this level and above
+func (l LOG_LEVEL_TYPE) ZerologLevel() zerolog.Level {
+	switch l {
+	case LOG_LEVEL_DEBUG:
+		return zerolog.TraceLevel
+	case LOG_LEVEL_WARN:
+		return zerolog.WarnLevel
+	case LOG_LEVEL_ERROR:
+		return zerolog.ErrorLevel
+	case LOG_LEVEL_FATAL:
+		return zerolog.FatalLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
+
+func determineLogLevel(logLevel string) (LOG_LEVEL_TYPE, error) {
+	switch logLevel {
+	case "":
+		return LOG_LEVEL_DEBUG, nil
+	case "info":
+		return LOG_LEVEL_INFO, nil
+	case "warn":
+		return LOG_LEVEL_WARN, nil
+	case "debug":
+		return LOG_LEVEL_DEBUG, nil
+	case "error":
+		return LOG_LEVEL_ERROR, nil
+	case "fatal":
+		return LOG_LEVEL_FATAL, nil
+	default:
+		return LOG_LEVEL_NOTFOUND, fmt.Errorf("invalid log level %q, expected one of debug, info, warn, error, fatal", logLevel)
+	}
+}
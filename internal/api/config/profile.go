@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Environments selectable with APP_ENV
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// profileDefaults override the default tags for each environment.
+// Config files, environment variables, secret files and flags still override them.
+var profileDefaults = map[string]map[string]string{
+	EnvDevelopment: {
+		"LOG_LEVEL":      "debug",
+		"LOG_FORMAT":     "console",
+		"STACK_TRACES":   "true",
+		"STRICT_CORS":    "false",
+		"PRINT_ROUTES":   "true",
+		"NO_STORE_CACHE": "true",
+		"MASK_ERRORS":    "false",
+		"LOG_EMAILS":     "true",
+
+		"DB_LOG_PARAMS":         "true",
+		"DB_QUERY_STATS_HEADER": "true",
+		"METRICS_ENABLED":       "true",
+	},
+	EnvTest: {
+		"LOG_LEVEL":      "warn",
+		"LOG_FORMAT":     "console",
+		"STACK_TRACES":   "true",
+		"STRICT_CORS":    "false",
+		"PRINT_ROUTES":   "false",
+		"NO_STORE_CACHE": "true",
+		"MASK_ERRORS":    "false",
+		"LOG_EMAILS":     "false",
+
+		"DB_QUERY_STATS_HEADER": "true",
+	},
+	EnvStaging: {
+		"LOG_LEVEL":      "info",
+		"STACK_TRACES":   "false",
+		"STRICT_CORS":    "true",
+		"PRINT_ROUTES":   "false",
+		"NO_STORE_CACHE": "false",
+		"MASK_ERRORS":    "true",
+		"LOG_EMAILS":     "false",
+	},
+	EnvProduction: {
+		"IS_PROD":        "true",
+		"LOG_LEVEL":      "info",
+		"STACK_TRACES":   "false",
+		"STRICT_CORS":    "true",
+		"PRINT_ROUTES":   "false",
+		"NO_STORE_CACHE": "false",
+		"MASK_ERRORS":    "true",
+		"LOG_EMAILS":     "false",
+	},
+}
+
+// Severity of a failed safety check
+type Severity int
+
+const (
+	// SeverityOff skips the check
+	SeverityOff Severity = iota
+	// SeverityWarn logs a warning and continues
+	SeverityWarn
+	// SeverityError refuses to start
+	SeverityError
+)
+
+// safetyCheck is a startup check and how strictly each environment enforces it
+type safetyCheck struct {
+	name     string
+	check    func(cfg *Config) error
+	severity map[string]Severity
+}
+
+// safetyChecks is the per-environment safety check matrix.
+// Environments missing from a check's severity map skip it.
+var safetyChecks = []safetyCheck{
+	{
+		name: "secret_key",
+		check: func(cfg *Config) error {
+			if cfg.SecretKey == "" || cfg.SecretKey == "qweasd123" || len(cfg.SecretKey) < 32 {
+				return fmt.Errorf("SECRET_KEY must be set to a secure value (minimum 32 characters)")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityError, EnvProduction: SeverityError},
+	},
+	{
+		name: "allowed_origins",
+		check: func(cfg *Config) error {
+			if strings.TrimSpace(cfg.AllowedOrigins) == "" {
+				return fmt.Errorf("ALLOWED_ORIGINS must list the allowed origins")
+			}
+			if strings.Contains(cfg.AllowedOrigins, "*") {
+				return fmt.Errorf("ALLOWED_ORIGINS cannot contain a wildcard")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityError, EnvProduction: SeverityError},
+	},
+	{
+		name: "database_tls",
+		check: func(cfg *Config) error {
+			if cfg.DatabaseURL == "" {
+				return nil
+			}
+			u, err := url.Parse(cfg.DatabaseURL)
+			if err != nil {
+				return nil // reported by validation
+			}
+			if mode := u.Query().Get("sslmode"); mode == "" || mode == "disable" || mode == "allow" || mode == "prefer" {
+				return fmt.Errorf("DATABASE_URL should use sslmode=require or verify-full")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "log_level",
+		check: func(cfg *Config) error {
+			if cfg.LogLevel == LOG_LEVEL_DEBUG {
+				return fmt.Errorf("LOG_LEVEL should be info or higher")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityWarn},
+	},
+	{
+		name: "stack_traces",
+		check: func(cfg *Config) error {
+			if cfg.StackTraces {
+				return fmt.Errorf("STACK_TRACES must be disabled")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "mask_errors",
+		check: func(cfg *Config) error {
+			if !cfg.MaskErrors {
+				return fmt.Errorf("MASK_ERRORS must be enabled")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "print_routes",
+		check: func(cfg *Config) error {
+			if cfg.PrintRoutes {
+				return fmt.Errorf("PRINT_ROUTES should be disabled")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvProduction: SeverityWarn},
+	},
+	{
+		name: "metrics_port",
+		check: func(cfg *Config) error {
+			if cfg.MetricsEnabled && cfg.MetricsPort == "" {
+				return fmt.Errorf("METRICS_PORT must be set when METRICS_ENABLED is, /metrics is unauthenticated and exposes routes, pool statistics and the schema version")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "log_bodies",
+		check: func(cfg *Config) error {
+			if cfg.LogBodies {
+				return fmt.Errorf("LOG_BODIES should only be enabled while debugging")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityWarn},
+	},
+	{
+		name: "log_emails",
+		check: func(cfg *Config) error {
+			if cfg.LogEmails {
+				return fmt.Errorf("LOG_EMAILS must be disabled, emails contain verification tokens")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "db_log_params",
+		check: func(cfg *Config) error {
+			if cfg.DBLogParams {
+				return fmt.Errorf("DB_LOG_PARAMS must be disabled, query parameters contain user data")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvStaging: SeverityWarn, EnvProduction: SeverityError},
+	},
+	{
+		name: "db_query_stats_header",
+		check: func(cfg *Config) error {
+			if cfg.DBQueryStatsHeader {
+				return fmt.Errorf("DB_QUERY_STATS_HEADER should be disabled, it exposes query counts to clients")
+			}
+			return nil
+		},
+		severity: map[string]Severity{EnvProduction: SeverityError},
+	},
+}
+
+// CheckSafety runs the safety checks enforced for APP_ENV.
+// Warnings are logged to log; failed checks with error severity are returned together.
+func (c *Config) CheckSafety(log zerolog.Logger) error {
+	var problems []string
+	for _, sc := range safetyChecks {
+		severity := sc.severity[c.AppEnv]
+		if severity == SeverityOff {
+			continue
+		}
+		err := sc.check(c)
+		if err == nil {
+			continue
+		}
+		if severity == SeverityWarn {
+			log.Warn().Str("check", sc.name).Str("app_env", c.AppEnv).Err(err).Msg("Safety check failed")
+			continue
+		}
+		problems = append(problems, "  - "+sc.name+": "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("safety checks failed for APP_ENV=%s (%d problems):\n%s", c.AppEnv, len(problems), strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Subscriber validates a reloaded configuration and returns the function applying it.
+// Nothing is applied unless every subscriber accepts the new configuration.
+type Subscriber func(cfg *Config) (apply func(), err error)
+
+// ReloadStats counts configuration reloads
+type ReloadStats struct {
+	Succeeded  uint64
+	Failed     uint64
+	LastReload time.Time
+}
+
+// Reloader re-reads the configuration on SIGHUP or config file change and applies
+// the settings tagged reload:"true" to its subscribers. Other settings keep their
+// startup value until the process is restarted.
+type Reloader struct {
+	opts    Options
+	log     zerolog.Logger
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	subscribers []Subscriber
+
+	succeeded  atomic.Uint64
+	failed     atomic.Uint64
+	lastReload atomic.Int64
+}
+
+// NewReloader creates a reloader starting from cfg, logging reloads to log. opts must be the
+// options cfg was loaded with.
+func NewReloader(cfg *Config, opts Options, log zerolog.Logger) *Reloader {
+	r := &Reloader{opts: opts, log: log}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the configuration currently in effect
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// Subscribe registers a subscriber called on every reload
+func (r *Reloader) Subscribe(s Subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, s)
+}
+
+// Stats returns the reload counters
+func (r *Reloader) Stats() ReloadStats {
+	stats := ReloadStats{
+		Succeeded: r.succeeded.Load(),
+		Failed:    r.failed.Load(),
+	}
+	if last := r.lastReload.Load(); last != 0 {
+		stats.LastReload = time.Unix(0, last)
+	}
+	return stats
+}
+
+// Reload loads the configuration again and applies the reloadable settings.
+// If loading or any subscriber rejects the new values, the old configuration stays in effect.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reload(); err != nil {
+		r.failed.Add(1)
+		r.log.Error().Err(err).Msg("Configuration reload rejected, keeping previous configuration")
+		return err
+	}
+
+	r.succeeded.Add(1)
+	r.lastReload.Store(time.Now().UnixNano())
+	return nil
+}
+
+func (r *Reloader) reload() error {
+	loaded, err := LoadWithOptions(Options{Args: r.opts.Args})
+	if err != nil {
+		return err
+	}
+
+	old := r.current.Load()
+	next, changes, ignored := mergeReloadable(old, loaded)
+
+	for _, name := range ignored {
+		r.log.Warn().Str("setting", name).Msg("Setting changed but requires a restart to take effect")
+	}
+	if len(changes) == 0 {
+		r.log.Info().Msg("Configuration reloaded, no reloadable settings changed")
+		return nil
+	}
+
+	applies := make([]func(), 0, len(r.subscribers))
+	for _, subscriber := range r.subscribers {
+		apply, err := subscriber(next)
+		if err != nil {
+			return err
+		}
+		if apply != nil {
+			applies = append(applies, apply)
+		}
+	}
+
+	r.current.Store(next)
+	for _, apply := range applies {
+		apply()
+	}
+
+	r.log.Info().Strs("changes", changes).Msg("Configuration reloaded")
+	return nil
+}
+
+// mergeReloadable returns a copy of old with the reloadable settings taken from loaded,
+// the list of applied changes, and the names of changed settings that need a restart
+func mergeReloadable(old, loaded *Config) (*Config, []string, []string) {
+	next := *old
+	next.sources = make(map[string]string, len(old.sources))
+	for name, source := range old.sources {
+		next.sources[name] = source
+	}
+
+	var changes, ignored []string
+
+	oldValue := reflect.ValueOf(old).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+	nextValue := reflect.ValueOf(&next).Elem()
+	t := oldValue.Type()
+
+	for _, field := range configFields() {
+		before := oldValue.Field(field.index)
+		after := loadedValue.Field(field.index)
+		if reflect.DeepEqual(before.Interface(), after.Interface()) {
+			continue
+		}
+
+		if t.Field(field.index).Tag.Get("reload") != "true" {
+			ignored = append(ignored, field.name)
+			continue
+		}
+
+		nextValue.Field(field.index).Set(after)
+		next.sources[field.name] = loaded.sources[field.name]
+		if t.Field(field.index).Tag.Get("secret") == "true" {
+			changes = append(changes, field.name)
+		} else {
+			changes = append(changes, fmt.Sprintf("%s %v -> %v", field.name, before.Interface(), after.Interface()))
+		}
+	}
+
+	return &next, changes, ignored
+}
+
+// Watch reloads the configuration on SIGHUP and, when pollInterval is positive,
+// whenever the modification time of the config file changes. It returns when ctx is done.
+func (r *Reloader) Watch(ctx context.Context, pollInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastMod := r.configFileModTime()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.log.Info().Msg("Received SIGHUP, reloading configuration")
+			r.Reload()
+			lastMod = r.configFileModTime()
+		case <-tick:
+			mod := r.configFileModTime()
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			r.log.Info().Msg("Config file changed, reloading configuration")
+			r.Reload()
+		}
+	}
+}
+
+// configFileModTime returns the modification time of the config file in use, if any
+func (r *Reloader) configFileModTime() time.Time {
+	cfg := r.current.Load()
+	path, err := findConfigFile(cfg.AppEnv, cfg.ConfigFile)
+	if err != nil || path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
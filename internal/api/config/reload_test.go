@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// unsetEnv unsets the variables for the test and restores them afterwards
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeEnvFile(t *testing.T, content string) {
+	t.Helper()
+	if err := os.WriteFile(".env", []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+}
+
+func TestReloadFromEnvFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	unsetEnv(t, "LOG_LEVEL", "RATE_LIMIT_MAX", "RATE_LIMIT_WINDOW")
+	t.Setenv("RATE_LIMIT_WINDOW", "2m")
+	t.Cleanup(func() { clear(envFileKeys) })
+
+	writeEnvFile(t, "LOG_LEVEL=info\nRATE_LIMIT_MAX=50\nRATE_LIMIT_WINDOW=5m\n")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.LogLevel != LOG_LEVEL_INFO || cfg.RateLimitMax != 50 {
+		t.Fatalf("LOG_LEVEL = %s, RATE_LIMIT_MAX = %d, want info and 50 from .env", cfg.LogLevel, cfg.RateLimitMax)
+	}
+
+	reloader := NewReloader(cfg, Options{}, zerolog.Nop())
+	writeEnvFile(t, "LOG_LEVEL=warn\nRATE_LIMIT_WINDOW=5m\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	got := reloader.Current()
+	if got.LogLevel != LOG_LEVEL_WARN {
+		t.Errorf("LOG_LEVEL = %s after reload, want warn from the edited .env", got.LogLevel)
+	}
+	if got.RateLimitMax != 100 {
+		t.Errorf("RATE_LIMIT_MAX = %d after reload, want the default 100 once removed from .env", got.RateLimitMax)
+	}
+	if got.RateLimitWindow != 2*time.Minute {
+		t.Errorf("RATE_LIMIT_WINDOW = %s after reload, want 2m from the process environment", got.RateLimitWindow)
+	}
+}
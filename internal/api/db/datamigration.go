@@ -0,0 +1,349 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// dataMigrationsTable tracks the progress of the Go data migrations
+const dataMigrationsTable = "data_migrations"
+
+// dataMigrationsTableVersion is the SQL migration creating dataMigrationsTable, every data
+// migration runs after it
+const dataMigrationsTableVersion = 7
+
+// defaultDataMigrationBatchSize is the batch size of data migrations not setting one
+const defaultDataMigrationBatchSize = 500
+
+// dataMigrationProgressInterval is how often progress is logged while a data migration runs
+const dataMigrationProgressInterval = 5 * time.Second
+
+// DataMigration is a migration written in Go, for backfills that plain SQL cannot express well.
+// It runs in batches, each in its own transaction recording how far it got, so an interrupted
+// migration resumes after the last committed batch.
+type DataMigration struct {
+	// Name identifies the migration in data_migrations, e.g. normalize_user_emails
+	Name string
+	// After is the SQL migration version the data migration needs; it runs once the schema
+	// reaches it and before any later SQL migration. It is at least 7, which creates the
+	// tracking table.
+	After uint
+	// BatchSize is passed to Batch as limit, 500 when zero
+	BatchSize int
+	// Batch migrates up to limit rows following cursor, "" on the first call, and returns the
+	// cursor of the last row and the number of rows it processed. Returning 0 rows completes
+	// the migration. A batch may run again after a failure, so it must be idempotent.
+	Batch func(ctx context.Context, tx *gorm.DB, cursor string, limit int) (next string, rows int, err error)
+}
+
+// DataMigrationState is a registered data migration and its progress in the database
+type DataMigrationState struct {
+	DataMigration
+	Cursor      string
+	RowsDone    int64
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// dataMigrations is the registry filled by RegisterDataMigration
+var dataMigrations []DataMigration
+
+// RegisterDataMigration adds a data migration to the registry. It is meant to be called from
+// init functions and panics on invalid or duplicate migrations.
+func RegisterDataMigration(migration DataMigration) {
+	if migration.Name == "" || migration.Batch == nil {
+		panic("db: data migration needs a name and a batch function")
+	}
+	if migration.Name != NormalizeMigrationName(migration.Name) {
+		panic(fmt.Sprintf("db: data migration name %q must be snake case", migration.Name))
+	}
+	for _, registered := range dataMigrations {
+		if registered.Name == migration.Name {
+			panic(fmt.Sprintf("db: data migration %q registered twice", migration.Name))
+		}
+	}
+	dataMigrations = append(dataMigrations, migration)
+}
+
+// DataMigrations returns the registered data migrations in the order they run: by version,
+// then by name
+func DataMigrations() []DataMigration {
+	migrations := append([]DataMigration(nil), dataMigrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		if migrations[i].After != migrations[j].After {
+			return migrations[i].After < migrations[j].After
+		}
+		return migrations[i].Name < migrations[j].Name
+	})
+	return migrations
+}
+
+// validateDataMigrations checks every data migration runs after an embedded SQL version that
+// has the tracking table
+func validateDataMigrations(migrations []DataMigration) error {
+	files, err := EmbeddedMigrations()
+	if err != nil {
+		return err
+	}
+	versions := map[uint]bool{}
+	for _, file := range files {
+		versions[file.Version] = true
+	}
+	for _, migration := range migrations {
+		if migration.After < dataMigrationsTableVersion {
+			return fmt.Errorf("data migration %s runs after version %d, before version %d creates the %s table",
+				migration.Name, migration.After, dataMigrationsTableVersion, dataMigrationsTable)
+		}
+		if !versions[migration.After] {
+			return fmt.Errorf("data migration %s runs after version %d, which is not an embedded migration", migration.Name, migration.After)
+		}
+	}
+	return nil
+}
+
+// openDataDB opens a GORM connection for running and tracking data migrations.
+// Queries are not logged, failures are returned to the caller.
+func openDataDB(ctx context.Context, databaseURL string) (*gorm.DB, func(), error) {
+	sqlDB, closeSQL, err := openSQL(ctx, databaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: gormlogger.Discard,
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+	})
+	if err != nil {
+		closeSQL()
+		return nil, nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+	return gormDB.WithContext(ctx), closeSQL, nil
+}
+
+// dataMigrationRow is a row of the tracking table
+type dataMigrationRow struct {
+	Name        string
+	Cursor      string
+	RowsDone    int64
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// loadDataMigrationRows reads the tracking table by name, empty when the schema is older than
+// the migration creating it
+func loadDataMigrationRows(gormDB *gorm.DB) (map[string]dataMigrationRow, error) {
+	var exists bool
+	if err := gormDB.Raw("SELECT to_regclass(?) IS NOT NULL", dataMigrationsTable).Scan(&exists).Error; err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dataMigrationsTable, err)
+	}
+
+	rows := map[string]dataMigrationRow{}
+	if !exists {
+		return rows, nil
+	}
+
+	var list []dataMigrationRow
+	if err := gormDB.Table(dataMigrationsTable).Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dataMigrationsTable, err)
+	}
+	for _, row := range list {
+		rows[row.Name] = row
+	}
+	return rows, nil
+}
+
+// DataMigrationStatus lists the registered data migrations with their progress
+func DataMigrationStatus(ctx context.Context, databaseURL string) ([]DataMigrationState, error) {
+	migrations := DataMigrations()
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	gormDB, closeDB, err := openDataDB(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	rows, err := loadDataMigrationRows(gormDB)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]DataMigrationState, len(migrations))
+	for i, migration := range migrations {
+		states[i] = DataMigrationState{DataMigration: migration}
+		if row, ok := rows[migration.Name]; ok {
+			startedAt := row.StartedAt
+			states[i].Cursor = row.Cursor
+			states[i].RowsDone = row.RowsDone
+			states[i].StartedAt = &startedAt
+			states[i].CompletedAt = row.CompletedAt
+		}
+	}
+	return states, nil
+}
+
+// pendingDataMigrations returns the data migrations not completed yet that run at or before
+// version target
+func pendingDataMigrations(gormDB *gorm.DB, target uint) ([]DataMigration, error) {
+	migrations := DataMigrations()
+	if err := validateDataMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := loadDataMigrationRows(gormDB)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []DataMigration
+	for _, migration := range migrations {
+		if migration.After <= target && rows[migration.Name].CompletedAt == nil {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// incompleteDataMigrations returns the names of the data migrations at or before version that
+// have not completed
+func incompleteDataMigrations(ctx context.Context, databaseURL string, version uint) ([]string, error) {
+	if len(dataMigrations) == 0 {
+		return nil, nil
+	}
+
+	gormDB, closeDB, err := openDataDB(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	pending, err := pendingDataMigrations(gormDB, version)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(pending))
+	for i, migration := range pending {
+		names[i] = migration.Name
+	}
+	return names, nil
+}
+
+// runDataMigration runs the batches of migration from its recorded cursor until it completes
+// or ctx is cancelled, recording progress with each batch and logging it through the logger
+// of ctx
+func runDataMigration(ctx context.Context, gormDB *gorm.DB, migration DataMigration) error {
+	log := zerolog.Ctx(ctx).With().Str("migration", migration.Name).Logger()
+
+	err := gormDB.Exec("INSERT INTO "+dataMigrationsTable+" (name, after_version) VALUES (?, ?) ON CONFLICT (name) DO NOTHING",
+		migration.Name, migration.After).Error
+	if err != nil {
+		return fmt.Errorf("failed to record data migration %s: %w", migration.Name, err)
+	}
+
+	var row dataMigrationRow
+	if err := gormDB.Table(dataMigrationsTable).Where("name = ?", migration.Name).Take(&row).Error; err != nil {
+		return fmt.Errorf("failed to read data migration %s: %w", migration.Name, err)
+	}
+	if row.CompletedAt != nil {
+		return nil
+	}
+
+	limit := migration.BatchSize
+	if limit <= 0 {
+		limit = defaultDataMigrationBatchSize
+	}
+
+	if row.RowsDone > 0 {
+		log.Info().Int64("rows", row.RowsDone).Msg("Resuming data migration")
+	} else {
+		log.Info().Msg("Running data migration")
+	}
+
+	start := time.Now()
+	lastLog := start
+	var migrated int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("data migration %s stopped after %d rows, it resumes from there on the next run: %w",
+				migration.Name, row.RowsDone, err)
+		}
+
+		var rows int
+		err := gormDB.Transaction(func(tx *gorm.DB) error {
+			next, n, err := migration.Batch(ctx, tx, row.Cursor, limit)
+			if err != nil {
+				return err
+			}
+			rows = n
+
+			updates := map[string]any{"updated_at": gorm.Expr("NOW()")}
+			if n == 0 {
+				updates["completed_at"] = gorm.Expr("NOW()")
+			} else {
+				updates["cursor"] = next
+				updates["rows_done"] = gorm.Expr("rows_done + ?", n)
+				row.Cursor = next
+			}
+			return tx.Table(dataMigrationsTable).Where("name = ?", migration.Name).Updates(updates).Error
+		})
+		if err != nil {
+			return fmt.Errorf("data migration %s failed after %d rows, it resumes from there on the next run: %w",
+				migration.Name, row.RowsDone, err)
+		}
+
+		if rows == 0 {
+			log.Info().Int64("rows", row.RowsDone).Dur("elapsed", time.Since(start)).Msg("Data migration completed")
+			return nil
+		}
+
+		row.RowsDone += int64(rows)
+		migrated += int64(rows)
+		if time.Since(lastLog) >= dataMigrationProgressInterval {
+			lastLog = time.Now()
+			log.Info().
+				Int64("rows", row.RowsDone).
+				Float64("rate", float64(migrated)/time.Since(start).Seconds()).
+				Dur("elapsed", time.Since(start)).
+				Msg("Data migration in progress")
+		}
+	}
+}
+
+// resetDataMigrationsAbove forgets the progress of data migrations after version, whose schema
+// was reverted, so they run again on the way up
+func resetDataMigrationsAbove(ctx context.Context, databaseURL string, version uint) error {
+	if len(dataMigrations) == 0 {
+		return nil
+	}
+
+	gormDB, closeDB, err := openDataDB(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	rows, err := loadDataMigrationRows(gormDB)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	var names []string
+	if err := gormDB.Raw("DELETE FROM "+dataMigrationsTable+" WHERE after_version > ? RETURNING name", version).Scan(&names).Error; err != nil {
+		return fmt.Errorf("failed to reset data migrations: %w", err)
+	}
+	for _, name := range names {
+		zerolog.Ctx(ctx).Info().Str("migration", name).Msg("Data migration was reset, it runs again on the next up")
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+// Package datamigrations registers the Go data migrations run by cmd/migrate and by cmd/api on
+// startup, interleaved with the embedded SQL migrations. Import it for its side effects:
+//
+//	import _ "go-boilerplate-api/internal/api/db/datamigrations"
+//
+// Add a migration with db.RegisterDataMigration from an init function in a file of its own.
+package datamigrations
@@ -0,0 +1,57 @@
+package datamigrations
+
+import (
+	"context"
+	"strings"
+
+	"go-boilerplate-api/internal/api/db"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// Login and email changes lowercase addresses, so accounts created with mixed case or
+// surrounding spaces could not sign in
+func init() {
+	db.RegisterDataMigration(db.DataMigration{
+		Name:  "normalize_user_emails",
+		After: 7,
+		Batch: normalizeUserEmails,
+	})
+}
+
+// normalizeUserEmails lowercases and trims the emails of the next limit users by id. Emails
+// whose normalized form belongs to another account are left for manual review.
+func normalizeUserEmails(ctx context.Context, tx *gorm.DB, cursor string, limit int) (string, int, error) {
+	if cursor == "" {
+		cursor = uuid.Nil.String()
+	}
+
+	var users []struct {
+		ID    string
+		Email string
+	}
+	err := tx.Table("users").Select("id, email").Where("id > ?", cursor).Order("id").Limit(limit).Scan(&users).Error
+	if err != nil || len(users) == 0 {
+		return cursor, 0, err
+	}
+
+	for _, user := range users {
+		email := strings.ToLower(strings.TrimSpace(user.Email))
+		if email == user.Email {
+			continue
+		}
+
+		result := tx.Exec("UPDATE users SET email = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM users WHERE email = ?)",
+			email, user.ID, email)
+		if result.Error != nil {
+			return cursor, 0, result.Error
+		}
+		if result.RowsAffected == 0 {
+			zerolog.Ctx(ctx).Warn().Str("migration", "normalize_user_emails").Str("user_id", user.ID).
+				Msg("Skipped user, the normalized email belongs to another account")
+		}
+	}
+	return users[len(users)-1].ID, len(users), nil
+}
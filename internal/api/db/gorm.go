@@ -7,51 +7,62 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 var (
 	// DB is the global GORM database instance
 	DB *gorm.DB
+
+	// closeGORMSQL releases the database/sql handle DB runs on
+	closeGORMSQL func()
 )
 
-// InitGORM initializes GORM with PostgreSQL connection
-func InitGORM(ctx context.Context, databaseURL string) error {
+// InitGORM initializes GORM on the shared connection pool, or on a pool of its own when
+// InitPool was not called for databaseURL.
+// Queries are logged through the application logger according to opts.
+func InitGORM(ctx context.Context, databaseURL string, opts QueryLogOptions) error {
 	if databaseURL == "" {
 		return fmt.Errorf("DATABASE_URL is required")
 	}
 
-	gormLogger := logger.Default.LogMode(logger.Silent)
+	sqlDB, closeSQL, err := openSQL(ctx, databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
 
-	// Parse database URL and create GORM connection
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{
-		Logger: gormLogger,
+	// Statements are prepared and cached per connection by pgx according to the statement
+	// cache mode of the pool, so GORM does not prepare them itself
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: newQueryLogger(opts),
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
-		PrepareStmt: true, // Enable prepared statements for better performance
+		// The pool was pinged when opened, and read replicas registered later on this
+		// configuration may be down without preventing startup
+		DisableAutomaticPing: true,
 	})
 
 	if err != nil {
+		closeSQL()
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Get underlying SQL DB for connection pool configuration
-	sqlDB, err := db.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	// Trace queries as children of the span in the statement context. Query variables are
+	// left out so user data does not reach the tracing backend.
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		closeSQL()
+		return fmt.Errorf("failed to register tracing plugin: %w", err)
 	}
 
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-	sqlDB.SetConnMaxIdleTime(time.Minute * 30)
-
-	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	// Count queries per request context and detect N+1 query patterns
+	if err := db.Use(&queryStatsPlugin{nPlusOneThreshold: opts.NPlusOneThreshold}); err != nil {
+		closeSQL()
+		return fmt.Errorf("failed to register query stats plugin: %w", err)
 	}
 
 	DB = db
+	closeGORMSQL = closeSQL
 	return nil
 }
 
@@ -60,14 +71,11 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
-// CloseGORM closes the GORM database connection
+// CloseGORM closes the GORM database connection. The shared pool stays open until ClosePool.
 func CloseGORM() error {
-	if DB != nil {
-		sqlDB, err := DB.DB()
-		if err != nil {
-			return err
-		}
-		return sqlDB.Close()
+	if closeGORMSQL != nil {
+		closeGORMSQL()
+		closeGORMSQL = nil
 	}
 	return nil
 }
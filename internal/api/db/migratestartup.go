@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Startup migration modes selectable with MIGRATE_ON_STARTUP
+const (
+	// MigrateOff neither applies nor checks migrations
+	MigrateOff = "off"
+	// MigrateApply applies pending migrations, one instance at a time
+	MigrateApply = "apply"
+	// MigrateVerify refuses to start unless the schema matches the embedded migrations
+	MigrateVerify = "verify"
+)
+
+// The advisory lock serializing migrations across instances and cmd/migrate, as the two int4
+// key form so waiting instances can find the holder in pg_locks. It is distinct from the lock
+// golang-migrate takes itself, which gives up after 15 seconds and does not cover data
+// migrations.
+const (
+	migrationLockClass = 0x6d696772 // "migr"
+	migrationLockID    = 1
+)
+
+// StartupMigrationOptions configures MigrateOnStartup
+type StartupMigrationOptions struct {
+	// Mode is MigrateOff, MigrateApply or MigrateVerify
+	Mode string
+	// LockTimeout bounds the wait for another instance to finish migrating
+	LockTimeout time.Duration
+	// PollInterval is how often the lock is retried and progress logged, 2s when zero
+	PollInterval time.Duration
+}
+
+// SchemaVersionError reports a schema version not matching the embedded migrations
+type SchemaVersionError struct {
+	Current  uint
+	Expected uint
+	Dirty    bool
+}
+
+func (e *SchemaVersionError) Error() string {
+	switch {
+	case e.Dirty:
+		return fmt.Sprintf("database schema is dirty at version %d: a migration failed half way, %s", e.Current, DirtyHint(e.Current))
+	case e.Current < e.Expected:
+		return fmt.Sprintf("database schema version %d is behind the embedded migrations (%d): run `go run ./cmd/migrate up` or start with MIGRATE_ON_STARTUP=apply", e.Current, e.Expected)
+	default:
+		return fmt.Sprintf("database schema version %d is ahead of the embedded migrations (%d): this build is older than the schema, deploy a newer build or migrate down", e.Current, e.Expected)
+	}
+}
+
+// MigrateOnStartup applies or verifies the embedded migrations before the server starts,
+// logging through the logger of ctx.
+// In apply mode, concurrent instances wait on an advisory lock so only one migrates and the
+// others find the schema up to date.
+func MigrateOnStartup(ctx context.Context, databaseURL string, opts StartupMigrationOptions) error {
+	switch opts.Mode {
+	case MigrateOff:
+		zerolog.Ctx(ctx).Warn().Msg("MIGRATE_ON_STARTUP=off: not checking the database schema version")
+		return nil
+	case MigrateVerify:
+		return verifySchemaVersion(ctx, databaseURL)
+	case MigrateApply, "":
+		return applyWithLock(ctx, databaseURL, opts)
+	default:
+		return fmt.Errorf("unknown startup migration mode %q", opts.Mode)
+	}
+}
+
+// latestEmbeddedVersion returns the highest version compiled into the binary
+func latestEmbeddedVersion() (uint, error) {
+	files, err := EmbeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+	return files[len(files)-1].Version, nil
+}
+
+// verifySchemaVersion fails unless the database is clean at the latest embedded version
+func verifySchemaVersion(ctx context.Context, databaseURL string) error {
+	expected, err := latestEmbeddedVersion()
+	if err != nil {
+		return err
+	}
+
+	current, dirty, err := GetMigrationVersion(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+
+	if dirty || current != expected {
+		return &SchemaVersionError{Current: current, Expected: expected, Dirty: dirty}
+	}
+
+	incomplete, err := incompleteDataMigrations(ctx, databaseURL, current)
+	if err != nil {
+		return err
+	}
+	if len(incomplete) > 0 {
+		return fmt.Errorf("data migrations %s have not completed: run `go run ./cmd/migrate up` or start with MIGRATE_ON_STARTUP=apply",
+			strings.Join(incomplete, ", "))
+	}
+
+	zerolog.Ctx(ctx).Info().Uint("version", current).Msg("Database schema version verified")
+	return nil
+}
+
+// WithMigrationLock runs fn while holding the advisory lock that serializes startup
+// migrations, waiting at most lockTimeout for another instance or cmd/migrate to release it.
+// It keeps data migrations from running twice at once.
+func WithMigrationLock(ctx context.Context, databaseURL string, lockTimeout time.Duration, fn func() error) error {
+	return withMigrationLock(ctx, databaseURL, StartupMigrationOptions{LockTimeout: lockTimeout}, fn)
+}
+
+// withMigrationLock runs fn while holding the migration lock on a dedicated connection
+func withMigrationLock(ctx context.Context, databaseURL string, opts StartupMigrationOptions, fn func() error) error {
+	sqlDB, closeSQL, err := openSQL(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeSQL()
+
+	// Session level advisory locks belong to one connection, so hold a dedicated one
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	if err := acquireMigrationLock(ctx, conn, opts); err != nil {
+		return err
+	}
+	defer func() {
+		// A fresh context so the lock is released even when ctx was cancelled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1, $2)", migrationLockClass, migrationLockID); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to release migration lock, it is released when the connection closes")
+		}
+	}()
+
+	return fn()
+}
+
+// applyWithLock runs the pending migrations while holding the startup migration lock
+func applyWithLock(ctx context.Context, databaseURL string, opts StartupMigrationOptions) error {
+	return withMigrationLock(ctx, databaseURL, opts, func() error {
+		return applyMigrations(ctx, databaseURL)
+	})
+}
+
+// applyMigrations runs the pending migrations, logging the versions before and after
+func applyMigrations(ctx context.Context, databaseURL string) error {
+	before, dirty, err := GetMigrationVersion(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return &SchemaVersionError{Current: before, Dirty: true}
+	}
+
+	start := time.Now()
+	if err := RunMigrations(ctx, databaseURL); err != nil {
+		version, dirty, versionErr := GetMigrationVersion(ctx, databaseURL)
+		if versionErr == nil && dirty {
+			return fmt.Errorf("%w (%v)", &SchemaVersionError{Current: version, Dirty: true}, err)
+		}
+		return err
+	}
+
+	after, _, err := GetMigrationVersion(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	if after == before {
+		zerolog.Ctx(ctx).Info().Uint("version", after).Msg("Database schema is up to date")
+	} else {
+		zerolog.Ctx(ctx).Info().Uint("from", before).Uint("to", after).Dur("elapsed", time.Since(start)).Msg("Database schema migrated")
+	}
+
+	expected, err := latestEmbeddedVersion()
+	if err == nil && after > expected {
+		zerolog.Ctx(ctx).Warn().Uint("version", after).Uint("embedded", expected).
+			Msg("Database schema is ahead of the embedded migrations, this build may be outdated")
+	}
+	return nil
+}
+
+// acquireMigrationLock polls the advisory lock until it is granted, ctx is done or the
+// timeout expires, logging which backend holds it while waiting
+func acquireMigrationLock(ctx context.Context, conn *sql.Conn, opts StartupMigrationOptions) error {
+	poll := opts.PollInterval
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	start := time.Now()
+	deadline := start.Add(opts.LockTimeout)
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", migrationLockClass, migrationLockID).Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			if waited := time.Since(start); waited >= poll {
+				zerolog.Ctx(ctx).Info().Dur("waited", waited).Msg("Acquired migration lock")
+			}
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timed out after %s waiting for the migration lock held by %s; if no migration is running, terminate that backend or raise MIGRATE_LOCK_TIMEOUT",
+				opts.LockTimeout, migrationLockHolder(ctx, conn))
+		}
+
+		zerolog.Ctx(ctx).Info().
+			Str("holder", migrationLockHolder(ctx, conn)).
+			Dur("waited", time.Since(start)).
+			Dur("timeout", opts.LockTimeout).
+			Msg("Waiting for another instance to finish migrating")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
+
+// migrationLockHolder describes the backend holding the migration lock, for log messages
+func migrationLockHolder(ctx context.Context, conn *sql.Conn) string {
+	var (
+		pid         int
+		application sql.NullString
+		address     sql.NullString
+		since       sql.NullTime
+	)
+	err := conn.QueryRowContext(ctx, `
+		SELECT l.pid, a.application_name, host(a.client_addr), a.backend_start
+		FROM pg_locks l LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted
+			AND l.classid::bigint = $1 AND l.objid::bigint = $2 AND l.objsubid = 2`,
+		migrationLockClass, migrationLockID,
+	).Scan(&pid, &application, &address, &since)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "another session (released since)"
+	}
+	if err != nil {
+		return "another session"
+	}
+
+	holder := fmt.Sprintf("pid %d", pid)
+	if address.Valid {
+		holder += " from " + address.String
+	}
+	if application.Valid && application.String != "" {
+		holder += " (" + application.String + ")"
+	}
+	if since.Valid {
+		holder += fmt.Sprintf(", connected %s ago", time.Since(since.Time).Round(time.Second))
+	}
+	return holder
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrationsDir is the source directory of the embedded migrations, relative to the module root
+const MigrationsDir = "internal/api/db/migrations"
+
+// Version formats of new migrations
+const (
+	// VersionSequential numbers migrations 000001, 000002, ...
+	VersionSequential = "seq"
+	// VersionTimestamp numbers migrations with their UTC creation time, e.g. 20240131154500,
+	// which avoids conflicts between branches
+	VersionTimestamp = "timestamp"
+)
+
+// sequentialDigits is the zero padding of sequential versions
+const sequentialDigits = 6
+
+// maxSequentialVersion is the largest sequential version, larger ones are timestamps
+const maxSequentialVersion = 999999
+
+// CreateMigrationOptions configures CreateMigration
+type CreateMigrationOptions struct {
+	// Format is VersionSequential (default) or VersionTimestamp
+	Format string
+	// Description is written to the header, a TODO when empty
+	Description string
+	// Now is the creation time of timestamp versions, time.Now when zero
+	Now time.Time
+	// UpSQL and DownSQL are written after the headers, e.g. a draft from DiffSchema
+	UpSQL   string
+	DownSQL string
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NormalizeMigrationName turns a free form name into the snake case used in file names,
+// e.g. "Add user-roles" becomes add_user_roles
+func NormalizeMigrationName(name string) string {
+	return strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// CreateMigration writes the paired .up.sql and .down.sql files of a new migration in dir,
+// with the Migration/Description/Safety header, and returns their paths.
+// It refuses to run when the existing migrations have gaps or unpaired files, when a migration
+// with the same name exists, and never overwrites a file.
+func CreateMigration(dir, name string, opts CreateMigrationOptions) ([]string, error) {
+	name = NormalizeMigrationName(name)
+	if name == "" {
+		return nil, fmt.Errorf("migration name must contain letters or digits")
+	}
+
+	existing, err := ListMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range existing {
+		if file.Name == name {
+			return nil, fmt.Errorf("migration %s already exists as version %d", name, file.Version)
+		}
+		if !file.HasUp || !file.HasDown {
+			return nil, fmt.Errorf("migration %06d_%s is missing its up or down file, fix it before creating a new one", file.Version, file.Name)
+		}
+	}
+
+	version, err := nextMigrationVersion(existing, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	id := version + "_" + name
+	description := opts.Description
+	if description == "" {
+		description = "TODO describe the change"
+	}
+
+	files := []struct {
+		path    string
+		content string
+	}{
+		{
+			path: filepath.Join(dir, id+".up.sql"),
+			content: fmt.Sprintf("-- Migration: %s\n-- Description: %s\n"+
+				"-- Safety: TODO Safe/Caution/Dangerous - describe locks taken and data modified\n\n", id, description) + opts.UpSQL,
+		},
+		{
+			path: filepath.Join(dir, id+".down.sql"),
+			content: fmt.Sprintf("-- Migration: %s (DOWN)\n-- Description: Rollback %s\n"+
+				"-- WARNING: TODO describe the data this rollback destroys\n\n", id, lowerFirst(description)) + opts.DownSQL,
+		},
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if err := writeNewFile(file.path, file.content); err != nil {
+			// Do not leave half a pair behind
+			for _, path := range paths {
+				os.Remove(path)
+			}
+			return nil, err
+		}
+		paths = append(paths, file.path)
+	}
+	return paths, nil
+}
+
+// nextMigrationVersion returns the formatted version of the next migration
+func nextMigrationVersion(existing []MigrationFile, opts CreateMigrationOptions) (string, error) {
+	var latest uint
+	if len(existing) > 0 {
+		latest = existing[len(existing)-1].Version
+	}
+
+	switch opts.Format {
+	case VersionSequential, "":
+		// A sequential version would sort before the timestamps, and never run where they did
+		if latest > maxSequentialVersion {
+			return "", fmt.Errorf("the migrations switched to timestamp versions (latest %d), create new ones with -format %s",
+				latest, VersionTimestamp)
+		}
+		// Sequential versions must be exactly 1..n, a gap means a missing or misnumbered file
+		for i, file := range existing {
+			if file.Version != uint(i+1) {
+				return "", fmt.Errorf("migration versions have a gap: expected %0*d, found %06d_%s",
+					sequentialDigits, i+1, file.Version, file.Name)
+			}
+		}
+		return fmt.Sprintf("%0*d", sequentialDigits, latest+1), nil
+
+	case VersionTimestamp:
+		now := opts.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		version := now.UTC().Format("20060102150405")
+		if n, _ := strconv.ParseUint(version, 10, 64); uint(n) <= latest {
+			return "", fmt.Errorf("timestamp version %s is not after the latest version %d", version, latest)
+		}
+		return version, nil
+
+	default:
+		return "", fmt.Errorf("unknown version format %q, expected %s or %s", opts.Format, VersionSequential, VersionTimestamp)
+	}
+}
+
+// writeNewFile creates path with content, failing if it already exists. A file it fails to
+// write is removed.
+func writeNewFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
@@ -0,0 +1,399 @@
+package db
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration lint rules, used in findings and suppression comments
+const (
+	LintNotNullWithoutDefault = "not-null-without-default"
+	LintIndexNotConcurrent    = "index-not-concurrent"
+	LintColumnTypeChange      = "column-type-change"
+	LintDropInUp              = "drop-in-up"
+	LintMissingDown           = "missing-down"
+	LintMixedTransaction      = "mixed-transaction"
+	LintSafetyHeader          = "safety-header"
+	LintSafetyMismatch        = "safety-mismatch"
+	LintDirective             = "lint-directive"
+)
+
+// LintRules describes every migration lint rule, by ID
+var LintRules = map[string]string{
+	LintNotNullWithoutDefault: "ADD COLUMN ... NOT NULL without DEFAULT fails on tables with rows",
+	LintIndexNotConcurrent:    "CREATE INDEX without CONCURRENTLY blocks writes to an existing table while it builds",
+	LintColumnTypeChange:      "ALTER COLUMN ... TYPE rewrites the table under an exclusive lock",
+	LintDropInUp:              "DROP TABLE/COLUMN/SCHEMA/TYPE/SEQUENCE in an up migration destroys data the previous release may still use",
+	LintMissingDown:           "the up migration has no down file to roll it back",
+	LintMixedTransaction:      "a statement that cannot run in a transaction shares its file with other statements",
+	LintSafetyHeader:          "the up migration has no -- Safety: Safe/Caution/Dangerous header",
+	LintSafetyMismatch:        "the header declares Safety: Safe but risky operations were flagged",
+	LintDirective:             "a lint:ignore comment names an unknown rule",
+}
+
+// LintFinding is a risky operation found in a migration file
+type LintFinding struct {
+	File    string
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s:%d: [%s] %s", f.File, f.Line, f.Rule, f.Message)
+}
+
+// sqlStatement is a statement of a migration file with comments and string contents removed
+// and whitespace collapsed, upper cased for matching
+type sqlStatement struct {
+	line   int
+	text   string
+	ignore map[string]bool
+}
+
+// sqlFile is a parsed migration file
+type sqlFile struct {
+	statements []sqlStatement
+	ignore     map[string]bool
+	directives []LintFinding
+}
+
+var (
+	lintDirectivePattern = regexp.MustCompile(`^--\s*lint:(ignore-file|ignore)\s+([a-z0-9,-]+)`)
+	safetyHeaderPattern  = regexp.MustCompile(`(?mi)^--\s*Safety:\s*([A-Za-z]*)`)
+	dollarQuotePattern   = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+	lintIdentifier         = `((?:"[^"]+"|[\w$]+)(?:\.(?:"[^"]+"|[\w$]+))?)`
+	createTablePattern     = regexp.MustCompile(`^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:UNLOGGED\s+|TEMP\s+|TEMPORARY\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + lintIdentifier)
+	createIndexPattern     = regexp.MustCompile(`^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:\S+\s+)?ON\s+(?:ONLY\s+)?` + lintIdentifier)
+	alterTablePattern      = regexp.MustCompile(`^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + lintIdentifier + `\s+(.*)$`)
+	dropObjectPattern      = regexp.MustCompile(`^DROP\s+(TABLE|SCHEMA|TYPE|SEQUENCE|MATERIALIZED\s+VIEW)\b`)
+	nonTransactionPattern  = regexp.MustCompile(`^(?:(?:CREATE\s+(?:UNIQUE\s+)?|DROP\s+)INDEX\s+CONCURRENTLY|REINDEX\b.*\bCONCURRENTLY|VACUUM|CREATE\s+DATABASE|DROP\s+DATABASE|ALTER\s+SYSTEM)\b`)
+	addColumnPattern       = regexp.MustCompile(`^ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?`)
+	addConstraintPattern   = regexp.MustCompile(`^ADD\s+(?:CONSTRAINT|PRIMARY|UNIQUE|FOREIGN|CHECK|EXCLUDE)\b`)
+	notNullPattern         = regexp.MustCompile(`\bNOT\s+NULL\b`)
+	defaultPattern         = regexp.MustCompile(`\b(?:DEFAULT|GENERATED)\b`)
+	alterColumnTypePattern = regexp.MustCompile(`^ALTER\s+(?:COLUMN\s+)?\S+\s+(?:SET\s+DATA\s+)?TYPE\b`)
+	dropColumnPattern      = regexp.MustCompile(`^DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?(\S+)`)
+)
+
+// LintEmbeddedMigrations lints the migrations compiled into the binary
+func LintEmbeddedMigrations() ([]LintFinding, error) {
+	return LintMigrations(migrationsFS, "migrations")
+}
+
+// LintMigrations flags risky operations in the migrations in dir of fsys, ordered by file and
+// line. A finding is suppressed by a "-- lint:ignore <rule>[,<rule>] <reason>" comment on the
+// line before the statement or on its last line, or for the whole file by
+// "-- lint:ignore-file <rule>[,<rule>] <reason>".
+func LintMigrations(fsys fs.FS, dir string) ([]LintFinding, error) {
+	migrations, err := ListMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	upFiles, downFiles, err := migrationFileNames(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, files := range []map[uint]string{upFiles, downFiles} {
+		for _, name := range files {
+			names = append(names, name)
+		}
+	}
+
+	parsed := map[string]*sqlFile{}
+	var findings []LintFinding
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		file := parseSQL(string(content))
+		parsed[name] = file
+		findings = append(findings, lintFile(name, string(content), file)...)
+	}
+
+	for _, migration := range migrations {
+		upFile, ok := upFiles[migration.Version]
+		if !ok || migration.HasDown || parsed[upFile].ignore[LintMissingDown] {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			File: upFile, Line: 1, Rule: LintMissingDown,
+			Message: "no down migration, add " + strings.TrimSuffix(upFile, ".up.sql") + ".down.sql to make it reversible",
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// lintFile applies the per file rules to a parsed migration
+func lintFile(name, content string, file *sqlFile) []LintFinding {
+	up := strings.HasSuffix(name, ".up.sql")
+	findings := append([]LintFinding(nil), file.directives...)
+	for i := range findings {
+		findings[i].File = name
+	}
+
+	var risky []LintFinding
+	report := func(stmt sqlStatement, rule, message string) {
+		if file.ignore[rule] || stmt.ignore[rule] {
+			return
+		}
+		risky = append(risky, LintFinding{File: name, Line: stmt.line, Rule: rule, Message: message})
+	}
+
+	// Tables created in the same file are empty, so locking and rewriting them is harmless
+	created := map[string]bool{}
+	for _, stmt := range file.statements {
+		if match := createTablePattern.FindStringSubmatch(stmt.text); match != nil {
+			created[normalizeTableName(match[1])] = true
+		}
+	}
+
+	for _, stmt := range file.statements {
+		if nonTransactionPattern.MatchString(stmt.text) && len(file.statements) > 1 {
+			report(stmt, LintMixedTransaction, fmt.Sprintf("%s cannot run inside a transaction, but the %d statements of this file run in one; move it to a migration of its own",
+				firstWords(stmt.text, 3), len(file.statements)))
+		}
+
+		if match := createIndexPattern.FindStringSubmatch(stmt.text); match != nil && match[1] == "" && !created[normalizeTableName(match[2])] {
+			report(stmt, LintIndexNotConcurrent, fmt.Sprintf("CREATE INDEX on existing table %s blocks writes while it builds; use CREATE INDEX CONCURRENTLY in a migration of its own",
+				strings.ToLower(match[2])))
+		}
+
+		if match := dropObjectPattern.FindStringSubmatch(stmt.text); match != nil && up {
+			report(stmt, LintDropInUp, fmt.Sprintf("DROP %s in an up migration destroys data; drop it once no deployed release uses it", match[1]))
+		}
+
+		match := alterTablePattern.FindStringSubmatch(stmt.text)
+		if match == nil {
+			continue
+		}
+		table := normalizeTableName(match[1])
+		for _, action := range splitTopLevel(match[2]) {
+			switch {
+			case addColumnPattern.MatchString(action) && !addConstraintPattern.MatchString(action):
+				if notNullPattern.MatchString(action) && !defaultPattern.MatchString(action) && !created[table] {
+					report(stmt, LintNotNullWithoutDefault, fmt.Sprintf("adding a NOT NULL column without DEFAULT to %s fails when it has rows; add a DEFAULT or backfill a nullable column first", table))
+				}
+			case alterColumnTypePattern.MatchString(action):
+				if !created[table] {
+					report(stmt, LintColumnTypeChange, fmt.Sprintf("changing a column type of %s rewrites the table under an exclusive lock; add a new column and backfill it instead", table))
+				}
+			case up && dropColumnPattern.MatchString(action):
+				if column := dropColumnPattern.FindStringSubmatch(action)[1]; column != "CONSTRAINT" {
+					report(stmt, LintDropInUp, fmt.Sprintf("dropping column %s.%s in an up migration destroys data; drop it once no deployed release uses it", table, strings.ToLower(column)))
+				}
+			}
+		}
+	}
+
+	if up {
+		header := safetyHeaderPattern.FindStringSubmatchIndex(content)
+		switch {
+		case header == nil:
+			if !file.ignore[LintSafetyHeader] {
+				findings = append(findings, LintFinding{File: name, Line: 1, Rule: LintSafetyHeader,
+					Message: "missing -- Safety: Safe/Caution/Dangerous header"})
+			}
+		default:
+			line := strings.Count(content[:header[0]], "\n") + 1
+			level := content[header[2]:header[3]]
+			switch strings.ToLower(level) {
+			case "safe":
+				if len(risky) > 0 && !file.ignore[LintSafetyMismatch] {
+					findings = append(findings, LintFinding{File: name, Line: line, Rule: LintSafetyMismatch,
+						Message: fmt.Sprintf("header declares Safety: Safe but %d risky operation(s) were flagged", len(risky))})
+				}
+			case "caution", "dangerous":
+			default:
+				if !file.ignore[LintSafetyHeader] {
+					findings = append(findings, LintFinding{File: name, Line: line, Rule: LintSafetyHeader,
+						Message: fmt.Sprintf("safety level %q is not Safe, Caution or Dangerous", level)})
+				}
+			}
+		}
+	}
+
+	return append(findings, risky...)
+}
+
+// parseSQL splits a migration into statements and collects its lint directives.
+// It understands -- and /* */ comments, quoted strings and identifiers, and dollar quoted
+// bodies, whose contents are dropped so keywords inside them are not matched.
+func parseSQL(src string) *sqlFile {
+	file := &sqlFile{ignore: map[string]bool{}}
+	var (
+		buf     strings.Builder
+		line    = 1
+		start   int
+		pending = map[string]bool{}
+		// lastEnd is the line of the previous statement's semicolon, for trailing directives
+		lastEnd int
+	)
+
+	write := func(s string) {
+		if buf.Len() == 0 {
+			start = line
+		}
+		buf.WriteString(s)
+	}
+	space := func() {
+		if buf.Len() > 0 && !strings.HasSuffix(buf.String(), " ") {
+			buf.WriteByte(' ')
+		}
+	}
+	flush := func() {
+		if text := strings.TrimSpace(buf.String()); text != "" {
+			file.statements = append(file.statements, sqlStatement{line: start, text: strings.ToUpper(text), ignore: pending})
+			pending = map[string]bool{}
+		}
+		buf.Reset()
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			space()
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			space()
+			i++
+
+		case strings.HasPrefix(src[i:], "--"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			comment := src[i : i+end]
+			if match := lintDirectivePattern.FindStringSubmatch(comment); match != nil {
+				target := pending
+				switch {
+				case match[1] == "ignore-file":
+					target = file.ignore
+				case buf.Len() > 0:
+					// Inside a statement, pending is attached to it when it ends
+				case lastEnd == line && len(file.statements) > 0:
+					target = file.statements[len(file.statements)-1].ignore
+				}
+				for _, rule := range strings.Split(match[2], ",") {
+					if _, ok := LintRules[rule]; !ok {
+						file.directives = append(file.directives, LintFinding{Line: line, Rule: LintDirective,
+							Message: fmt.Sprintf("unknown rule %q in lint:%s", rule, match[1])})
+						continue
+					}
+					target[rule] = true
+				}
+			}
+			i += end
+
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			space()
+			i += end + 4
+
+		case c == '\'' || c == '"':
+			// Quoted identifiers are kept, string contents are replaced by ?
+			j := i + 1
+			for j < len(src) {
+				if src[j] == c {
+					if j+1 < len(src) && src[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if c == '"' {
+				write(src[i:min(j+1, len(src))])
+			} else {
+				write("'?'")
+			}
+			line += strings.Count(src[i:min(j+1, len(src))], "\n")
+			i = j + 1
+
+		case c == '$' && dollarQuotePattern.MatchString(src[i:]) && (i == 0 || !isIdentByte(src[i-1])):
+			tag := dollarQuotePattern.FindString(src[i:])
+			end := strings.Index(src[i+len(tag):], tag)
+			if end < 0 {
+				end = len(src) - i - len(tag)
+			}
+			line += strings.Count(src[i:i+len(tag)+end], "\n")
+			write("$$?$$")
+			i += 2*len(tag) + end
+
+		case c == ';':
+			flush()
+			lastEnd = line
+			i++
+
+		default:
+			write(src[i : i+1])
+			i++
+		}
+	}
+	flush()
+	return file
+}
+
+// splitTopLevel splits the actions of an ALTER TABLE on commas outside parentheses
+func splitTopLevel(s string) []string {
+	var (
+		parts []string
+		depth int
+		last  int
+	)
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[last:i]))
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[last:]))
+}
+
+// normalizeTableName lower cases a table name and removes quotes and the public schema
+func normalizeTableName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, `"`, ""))
+	return strings.TrimPrefix(name, "public.")
+}
+
+func firstWords(s string, n int) string {
+	words := strings.Fields(s)
+	if len(words) > n {
+		words = words[:n]
+	}
+	return strings.Join(words, " ")
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,310 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseSQLStatements(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		texts []string
+		lines []int
+	}{
+		{
+			name:  "splits on semicolons and collapses whitespace",
+			src:   "create table a (id int);\n\nalter  table a\n\tadd column b int;",
+			texts: []string{"CREATE TABLE A (ID INT)", "ALTER TABLE A ADD COLUMN B INT"},
+			lines: []int{1, 3},
+		},
+		{
+			name:  "statement without trailing semicolon",
+			src:   "select 1",
+			texts: []string{"SELECT 1"},
+			lines: []int{1},
+		},
+		{
+			name:  "line comments are dropped",
+			src:   "-- drop table users;\nselect 1; -- ; create index\nselect 2;",
+			texts: []string{"SELECT 1", "SELECT 2"},
+			lines: []int{2, 3},
+		},
+		{
+			name:  "block comments are dropped and count lines",
+			src:   "/* drop table users;\n create index x on y(z); */ select 1;\nselect 2;",
+			texts: []string{"SELECT 1", "SELECT 2"},
+			lines: []int{2, 3},
+		},
+		{
+			name:  "string contents are replaced",
+			src:   "insert into t values ('a;b', 'it''s; drop table x');",
+			texts: []string{"INSERT INTO T VALUES ('?', '?')"},
+			lines: []int{1},
+		},
+		{
+			name:  "quoted identifiers are kept",
+			src:   `create index on "My Table"("a;b");`,
+			texts: []string{`CREATE INDEX ON "MY TABLE"("A;B")`},
+			lines: []int{1},
+		},
+		{
+			name:  "dollar quoted bodies are replaced",
+			src:   "create function f() returns void as $$\nbegin\n  drop table x;\nend;\n$$ language plpgsql;\nselect 1;",
+			texts: []string{"CREATE FUNCTION F() RETURNS VOID AS $$?$$ LANGUAGE PLPGSQL", "SELECT 1"},
+			lines: []int{1, 6},
+		},
+		{
+			name:  "tagged dollar quotes end at the same tag",
+			src:   "do $body$ begin perform $$;$$; end $body$;\nselect 1;",
+			texts: []string{"DO $$?$$", "SELECT 1"},
+			lines: []int{1, 2},
+		},
+		{
+			name:  "positional parameters are not dollar quotes",
+			src:   "select $1, a$b$c from t; select 2;",
+			texts: []string{"SELECT $1, A$B$C FROM T", "SELECT 2"},
+			lines: []int{1, 1},
+		},
+		{
+			name:  "unterminated dollar quote runs to the end",
+			src:   "do $$ begin; select 1;",
+			texts: []string{"DO $$?$$"},
+			lines: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := parseSQL(tt.src)
+			var texts []string
+			var lines []int
+			for _, stmt := range file.statements {
+				texts = append(texts, stmt.text)
+				lines = append(lines, stmt.line)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) {
+				t.Errorf("statements = %q, want %q", texts, tt.texts)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestParseSQLDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		ignore     []map[string]bool
+		fileIgnore map[string]bool
+		directives []int
+	}{
+		{
+			name:   "line before applies to the next statement only",
+			src:    "-- lint:ignore index-not-concurrent small table\ncreate index on a(b);\ncreate index on c(d);",
+			ignore: []map[string]bool{{LintIndexNotConcurrent: true}, {}},
+		},
+		{
+			name:   "comment lines between the directive and the statement",
+			src:    "-- lint:ignore drop-in-up unused since v2\n-- more context\ndrop table a;",
+			ignore: []map[string]bool{{LintDropInUp: true}},
+		},
+		{
+			name:   "end of the statement's last line",
+			src:    "create index on a(b); -- lint:ignore index-not-concurrent small table\ncreate index on c(d);",
+			ignore: []map[string]bool{{LintIndexNotConcurrent: true}, {}},
+		},
+		{
+			name:   "inside a statement",
+			src:    "alter table a\n  -- lint:ignore column-type-change empty in practice\n  alter column b type text;",
+			ignore: []map[string]bool{{LintColumnTypeChange: true}},
+		},
+		{
+			name:   "several rules",
+			src:    "-- lint:ignore drop-in-up,column-type-change replaced by c\nalter table a drop column b, alter column c type text;",
+			ignore: []map[string]bool{{LintDropInUp: true, LintColumnTypeChange: true}},
+		},
+		{
+			name:       "whole file",
+			src:        "create index on a(b);\n-- lint:ignore-file missing-down,index-not-concurrent cannot be reverted\ncreate index on c(d);",
+			ignore:     []map[string]bool{{}, {}},
+			fileIgnore: map[string]bool{LintMissingDown: true, LintIndexNotConcurrent: true},
+		},
+		{
+			name:       "unknown rules are reported and the known ones kept",
+			src:        "select 1;\n-- lint:ignore drop-in-up,no-such-rule typo\ndrop table a;",
+			ignore:     []map[string]bool{{}, {LintDropInUp: true}},
+			directives: []int{2},
+		},
+		{
+			name:   "directives inside block comments and strings are ignored",
+			src:    "/*\n-- lint:ignore drop-in-up\n*/ drop table a;\nselect '-- lint:ignore drop-in-up';",
+			ignore: []map[string]bool{{}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := parseSQL(tt.src)
+			var ignore []map[string]bool
+			for _, stmt := range file.statements {
+				ignore = append(ignore, stmt.ignore)
+			}
+			if !reflect.DeepEqual(ignore, tt.ignore) {
+				t.Errorf("statement ignores = %v, want %v", ignore, tt.ignore)
+			}
+			fileIgnore := tt.fileIgnore
+			if fileIgnore == nil {
+				fileIgnore = map[string]bool{}
+			}
+			if !reflect.DeepEqual(file.ignore, fileIgnore) {
+				t.Errorf("file ignores = %v, want %v", file.ignore, fileIgnore)
+			}
+			var directives []int
+			for _, finding := range file.directives {
+				if finding.Rule != LintDirective {
+					t.Errorf("directive finding has rule %s", finding.Rule)
+				}
+				directives = append(directives, finding.Line)
+			}
+			if !reflect.DeepEqual(directives, tt.directives) {
+				t.Errorf("directive findings on lines %v, want %v", directives, tt.directives)
+			}
+		})
+	}
+}
+
+// lintHeader is a valid header for lint test migrations
+const lintHeader = "-- Safety: Caution - test\n"
+
+func TestLintMigrationsRules(t *testing.T) {
+	tests := []struct {
+		name string
+		up   string
+		// down is the down file, none when "-"
+		down string
+		want []string
+	}{
+		{
+			name: "clean migration",
+			up:   "-- Safety: Safe - new table\nCREATE TABLE a (id INT NOT NULL);\nCREATE INDEX idx_a ON a(id);",
+		},
+		{
+			name: "not null without default",
+			up:   lintHeader + "ALTER TABLE users ADD COLUMN plan TEXT NOT NULL;",
+			want: []string{"2:" + LintNotNullWithoutDefault},
+		},
+		{
+			name: "not null with default or on a new table",
+			up: lintHeader + "ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free';\n" +
+				"CREATE TABLE a (id INT);\nALTER TABLE a ADD COLUMN b INT NOT NULL;\n" +
+				"ALTER TABLE users ADD CONSTRAINT users_plan_not_null CHECK (plan IS NOT NULL);",
+		},
+		{
+			name: "index not concurrent",
+			up:   lintHeader + "CREATE UNIQUE INDEX IF NOT EXISTS idx_users_plan ON public.users(plan);",
+			want: []string{"2:" + LintIndexNotConcurrent},
+		},
+		{
+			name: "concurrent index alone in its file",
+			up:   lintHeader + "CREATE INDEX CONCURRENTLY idx_users_plan ON users(plan);",
+		},
+		{
+			name: "column type change",
+			up:   lintHeader + "ALTER TABLE users ALTER COLUMN email SET DATA TYPE TEXT;",
+			want: []string{"2:" + LintColumnTypeChange},
+		},
+		{
+			name: "drop table and column in up",
+			up:   lintHeader + "DROP TABLE IF EXISTS legacy;\nALTER TABLE users DROP COLUMN IF EXISTS nickname, DROP CONSTRAINT users_nickname_key;",
+			want: []string{"2:" + LintDropInUp, "3:" + LintDropInUp},
+		},
+		{
+			name: "drops in down files are expected",
+			up:   lintHeader + "CREATE TABLE a (id INT);",
+			down: "DROP TABLE a;\nALTER TABLE users DROP COLUMN b;",
+		},
+		{
+			name: "missing down",
+			up:   lintHeader + "SELECT 1;",
+			down: "-",
+			want: []string{"1:" + LintMissingDown},
+		},
+		{
+			name: "missing down ignored for the file",
+			up:   lintHeader + "-- lint:ignore-file missing-down data fix\nSELECT 1;",
+			down: "-",
+		},
+		{
+			name: "mixed transaction",
+			up:   lintHeader + "CREATE TABLE a (id INT);\nCREATE INDEX CONCURRENTLY idx_b ON b(id);",
+			want: []string{"3:" + LintMixedTransaction},
+		},
+		{
+			name: "missing safety header",
+			up:   "CREATE TABLE a (id INT);",
+			want: []string{"1:" + LintSafetyHeader},
+		},
+		{
+			name: "unknown safety level",
+			up:   "-- Migration: x\n-- Safety: TODO Safe/Caution/Dangerous\nCREATE TABLE a (id INT);",
+			want: []string{"2:" + LintSafetyHeader},
+		},
+		{
+			name: "safe header with risky operations",
+			up:   "-- Safety: Safe\nCREATE INDEX idx_users_plan ON users(plan);",
+			want: []string{"1:" + LintSafetyMismatch, "2:" + LintIndexNotConcurrent},
+		},
+		{
+			name: "suppressed findings do not make a safe header wrong",
+			up:   "-- Safety: Safe\n-- lint:ignore index-not-concurrent few rows\nCREATE INDEX idx_users_plan ON users(plan);",
+		},
+		{
+			name: "unknown rule in a directive",
+			up:   lintHeader + "-- lint:ignore index-not-concurent few rows\nCREATE INDEX idx_users_plan ON users(plan);",
+			want: []string{"2:" + LintDirective, "3:" + LintIndexNotConcurrent},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"000001_test.up.sql": {Data: []byte(tt.up)}}
+			switch tt.down {
+			case "-":
+			case "":
+				fsys["000001_test.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			default:
+				fsys["000001_test.down.sql"] = &fstest.MapFile{Data: []byte(tt.down)}
+			}
+
+			findings, err := LintMigrations(fsys, ".")
+			if err != nil {
+				t.Fatalf("LintMigrations failed: %v", err)
+			}
+			var got []string
+			for _, finding := range findings {
+				if finding.File != "000001_test.up.sql" {
+					t.Errorf("finding in %s: %s", finding.File, finding)
+				}
+				got = append(got, fmt.Sprintf("%d:%s", finding.Line, finding.Rule))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v\n%v", got, tt.want, findings)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsLintClean(t *testing.T) {
+	findings, err := LintEmbeddedMigrations()
+	if err != nil {
+		t.Fatalf("LintEmbeddedMigrations failed: %v", err)
+	}
+	for _, finding := range findings {
+		t.Errorf("embedded migration finding: %s", finding)
+	}
+}
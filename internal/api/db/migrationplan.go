@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"time"
+)
+
+// Migration directions
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// planLockTimeout bounds how long a dry run waits for table locks, so it fails instead of
+// queueing behind live traffic and blocking it in turn
+const planLockTimeout = 5 * time.Second
+
+var (
+	// transactionControlPattern matches top level statements ending or replacing the dry run's
+	// transaction, which would commit the migrations it was meant to roll back
+	transactionControlPattern = regexp.MustCompile(`^(?:BEGIN|START\s+TRANSACTION|COMMIT|END|ROLLBACK|ABORT|PREPARE\s+TRANSACTION|SAVEPOINT|RELEASE)\b`)
+	// concurrentlyPattern matches statements building or dropping without the usual locks,
+	// which cannot run inside a transaction
+	concurrentlyPattern = regexp.MustCompile(`\bCONCURRENTLY\b`)
+)
+
+// MigrationPlan is the migrations that would run from the current version
+type MigrationPlan struct {
+	Current   uint
+	Direction string
+	Steps     []PlannedMigration
+}
+
+// PlannedMigration is one migration file of a plan
+type PlannedMigration struct {
+	Version uint
+	Name    string
+	File    string
+	SQL     string
+	// NonTransactional is set when the file has statements that cannot run in a transaction,
+	// such as CREATE INDEX CONCURRENTLY, so a dry run skips it
+	NonTransactional bool
+	// TransactionControl is set when the file has top level BEGIN, COMMIT, ROLLBACK or similar
+	// statements, which would end the dry run's transaction, so a dry run refuses to run it
+	TransactionControl bool
+	// Data is set for Go data migrations, which have no SQL and are skipped by a dry run
+	Data *DataMigration
+}
+
+// DryRunResult is the outcome of one step of a dry run
+type DryRunResult struct {
+	Step     PlannedMigration
+	Skipped  bool
+	Duration time.Duration
+	Err      error
+}
+
+// PlanMigrations returns the embedded migrations that would run from the current version of
+// the database: every pending up migration, or the last n down migrations. For up, n > 0 limits
+// the plan to the next n.
+func PlanMigrations(ctx context.Context, databaseURL, direction string, n int) (*MigrationPlan, error) {
+	current, dirty, err := GetMigrationVersion(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, &SchemaVersionError{Current: current, Dirty: true}
+	}
+
+	states, err := DataMigrationStatus(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	var pendingData []DataMigration
+	for _, state := range states {
+		if state.CompletedAt == nil {
+			pendingData = append(pendingData, state.DataMigration)
+		}
+	}
+	return planFrom(migrationsFS, "migrations", current, direction, n, pendingData)
+}
+
+// planFrom builds the plan from version current with the migrations in dir of fsys. Pending
+// data migrations are placed after the SQL migration they need in up plans.
+func planFrom(fsys fs.FS, dir string, current uint, direction string, n int, pendingData []DataMigration) (*MigrationPlan, error) {
+	migrations, err := ListMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	upFiles, downFiles, err := migrationFileNames(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigrationPlan{Current: current, Direction: direction}
+	var selected []MigrationFile
+	switch direction {
+	case DirectionUp:
+		for _, migration := range migrations {
+			if migration.Version > current && (n <= 0 || len(selected) < n) {
+				selected = append(selected, migration)
+			}
+		}
+	case DirectionDown:
+		if n <= 0 {
+			n = 1
+		}
+		known := current == 0
+		for i := len(migrations) - 1; i >= 0 && len(selected) < n; i-- {
+			if migrations[i].Version == current {
+				known = true
+			}
+			if migrations[i].Version <= current {
+				selected = append(selected, migrations[i])
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("database version %d is not an embedded migration, this build cannot revert it", current)
+		}
+	default:
+		return nil, fmt.Errorf("unknown direction %q, expected %s or %s", direction, DirectionUp, DirectionDown)
+	}
+
+	addData := func(after func(uint) bool) {
+		for i := range pendingData {
+			if after(pendingData[i].After) {
+				plan.Steps = append(plan.Steps, PlannedMigration{Version: pendingData[i].After, Name: pendingData[i].Name, Data: &pendingData[i]})
+			}
+		}
+	}
+	// Data migrations whose version is already reached run before any SQL migration
+	if direction == DirectionUp {
+		addData(func(after uint) bool { return after <= current })
+	}
+
+	for _, migration := range selected {
+		file := upFiles[migration.Version]
+		if direction == DirectionDown {
+			file = downFiles[migration.Version]
+		}
+		if file == "" {
+			return nil, fmt.Errorf("migration %d_%s has no %s file", migration.Version, migration.Name, direction)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		step := PlannedMigration{Version: migration.Version, Name: migration.Name, File: file, SQL: string(content)}
+		// Statements are matched without comments, strings and dollar quoted bodies, so a
+		// function's BEGIN ... END or a quoted keyword does not count
+		for _, stmt := range parseSQL(step.SQL).statements {
+			if nonTransactionPattern.MatchString(stmt.text) || concurrentlyPattern.MatchString(stmt.text) {
+				step.NonTransactional = true
+			}
+			if transactionControlPattern.MatchString(stmt.text) {
+				step.TransactionControl = true
+			}
+		}
+		plan.Steps = append(plan.Steps, step)
+
+		if direction == DirectionUp {
+			addData(func(after uint) bool { return after == migration.Version })
+		}
+	}
+	return plan, nil
+}
+
+// DryRunPlan applies the steps of plan in one transaction that is always rolled back, stopping
+// at the first failure. Steps that cannot run in a transaction or that control their own are
+// skipped, and migrations after them may fail if they depend on them.
+func DryRunPlan(ctx context.Context, databaseURL string, plan *MigrationPlan) ([]DryRunResult, error) {
+	sqlDB, closeSQL, err := openSQL(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSQL()
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Never commit, whatever happens below
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = '%dms'", planLockTimeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("failed to set lock timeout: %w", err)
+	}
+
+	results := make([]DryRunResult, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		if step.NonTransactional || step.TransactionControl || step.Data != nil {
+			results = append(results, DryRunResult{Step: step, Skipped: true})
+			continue
+		}
+
+		start := time.Now()
+		_, err := tx.ExecContext(ctx, step.SQL)
+		results = append(results, DryRunResult{Step: step, Duration: time.Since(start), Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return results, nil
+}
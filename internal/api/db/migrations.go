@@ -2,107 +2,432 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
-	_ "github.com/jackc/pgx/v5/stdlib" // Required for database/sql compatibility
+	"github.com/rs/zerolog"
+	"gorm.io/plugin/dbresolver"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-func RunMigrations(ctx context.Context, databaseURL string) error {
-	if databaseURL == "" {
-		return fmt.Errorf("DATABASE_URL is required for migrations")
+// migrationsTable is the version tracking table of golang-migrate
+const migrationsTable = "schema_migrations"
+
+// migrationFilePattern matches <version>_<name>.<up|down>.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// MigrationFile is an embedded migration and the directions it has files for
+type MigrationFile struct {
+	Version uint
+	Name    string
+	HasUp   bool
+	HasDown bool
+}
+
+// MigrationState is an embedded migration and whether it is applied to the database
+type MigrationState struct {
+	MigrationFile
+	Applied bool
+	// Dirty is set on the current version when it failed half way
+	Dirty bool
+}
+
+// EmbeddedMigrations lists the migrations compiled into the binary, ordered by version
+func EmbeddedMigrations() ([]MigrationFile, error) {
+	return ListMigrations(migrationsFS, "migrations")
+}
+
+// PreviousMigrationVersion returns the embedded migration version preceding version, or -1
+// when version is the first. Versions are not consecutive once timestamp versions are used, so
+// this is the version to force to retry a failed migration.
+func PreviousMigrationVersion(version uint) (int, error) {
+	files, err := EmbeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	previous := -1
+	for _, file := range files {
+		if file.Version >= version {
+			break
+		}
+		previous = int(file.Version)
+	}
+	return previous, nil
+}
+
+// DirtyHint tells how to resolve a migration that failed half way at version
+func DirtyHint(version uint) string {
+	hint := fmt.Sprintf("repair it, then run `go run ./cmd/migrate force %d` if you completed it by hand", version)
+	if previous, err := PreviousMigrationVersion(version); err == nil {
+		hint += fmt.Sprintf(", or `go run ./cmd/migrate force %d` if you undid it, then `up` to retry it", previous)
+	}
+	return hint
+}
+
+// ListMigrations lists the migrations in dir of fsys, ordered by version.
+// It fails on file names not following <version>_<name>.<up|down>.sql and on versions
+// used with two different names.
+func ListMigrations(fsys fs.FS, dir string) ([]MigrationFile, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
 	}
 
-	db, err := sql.Open("pgx", databaseURL)
+	byVersion := map[uint]*MigrationFile{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.<up|down>.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+
+		file, ok := byVersion[uint(version)]
+		if !ok {
+			file = &MigrationFile{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = file
+		} else if file.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, file.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			file.HasUp = true
+		} else {
+			file.HasDown = true
+		}
+	}
+
+	files := make([]MigrationFile, 0, len(byVersion))
+	for _, file := range byVersion {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Version < files[j].Version })
+	return files, nil
+}
+
+// migrationFileNames maps the versions in dir of fsys to their up and down file names
+func migrationFileNames(fsys fs.FS, dir string) (up, down map[uint]string, err error) {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	up, down = map[uint]string{}, map[uint]string{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			up[uint(version)] = entry.Name()
+		} else {
+			down[uint(version)] = entry.Name()
+		}
+	}
+	return up, down, nil
+}
+
+// migrateLogger logs the migrations golang-migrate applies
+type migrateLogger struct {
+	log *zerolog.Logger
+}
+
+func (l migrateLogger) Printf(format string, v ...interface{}) {
+	l.log.Info().Msg(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
+
+// openMigrate connects to databaseURL and returns a migrate instance over the embedded
+// migrations. Cancelling ctx stops after the migration in progress instead of leaving the
+// database dirty. closeMigrate must be called to release the connection.
+func openMigrate(ctx context.Context, databaseURL string) (m *migrate.Migrate, closeMigrate func(), err error) {
+	if databaseURL == "" {
+		return nil, nil, fmt.Errorf("DATABASE_URL is required for migrations")
 	}
-	defer db.Close()
 
-	// Ping to verify connection
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	db, closeSQL, err := openSQL(ctx, databaseURL)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Create postgres driver instance
 	driver, err := postgres.WithInstance(db, &postgres.Config{
-		MigrationsTable: "schema_migrations", // Version tracking table
+		MigrationsTable: migrationsTable, // Version tracking table
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create postgres driver: %w", err)
+		closeSQL()
+		return nil, nil, fmt.Errorf("failed to create postgres driver: %w", err)
 	}
 
 	// Create source driver from embedded filesystem
 	sourceDriver, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		return fmt.Errorf("failed to create source driver: %w", err)
+		driver.Close()
+		closeSQL()
+		return nil, nil, fmt.Errorf("failed to create source driver: %w", err)
 	}
 
 	// Create migrate instance
-	m, err := migrate.NewWithInstance(
+	m, err = migrate.NewWithInstance(
 		"iofs",
 		sourceDriver,
 		"postgres",
 		driver,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		driver.Close()
+		closeSQL()
+		return nil, nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	m.Log = migrateLogger{log: zerolog.Ctx(ctx)}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	return m, func() {
+		close(done)
+		m.Close()
+		closeSQL()
+	}, nil
+}
+
+// ignoreNoChange treats an already reached target as success
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// currentVersion returns the version of m, 0 when no migration is applied
+func currentVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// migrateUp runs the pending data migrations up to version target, first migrating the schema
+// to the version each one needs, then calls finish to apply the remaining SQL migrations
+func migrateUp(ctx context.Context, m *migrate.Migrate, databaseURL string, target uint, finish func() error) error {
+	if len(dataMigrations) == 0 {
+		return finish()
+	}
+
+	gormDB, closeDB, err := openDataDB(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	pending, err := pendingDataMigrations(gormDB, target)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		current, dirty, err := currentVersion(m)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return migrate.ErrDirty{Version: int(current)}
+		}
+		if migration.After > current {
+			if err := m.Migrate(migration.After); err != nil {
+				return err
+			}
+		}
+		if err := runDataMigration(ctx, gormDB, migration); err != nil {
+			return err
+		}
 	}
+	return finish()
+}
 
-	// Run migrations
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
+func RunMigrations(ctx context.Context, databaseURL string) error {
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeMigrate()
+
+	latest, err := latestEmbeddedVersion()
+	if err != nil {
+		return err
+	}
+
+	// Run migrations, no new migrations to apply is fine
+	err = migrateUp(ctx, m, databaseURL, latest, func() error {
+		return ignoreNoChange(m.Up())
+	})
+	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	if err == migrate.ErrNoChange {
-		// No new migrations to apply - this is fine
-		return nil
+	return nil
+}
+
+// MigrateSteps applies the next n migrations, or reverts the last -n when n is negative
+func MigrateSteps(ctx context.Context, databaseURL string, n int) error {
+	if n == 0 {
+		return fmt.Errorf("number of steps must not be 0")
+	}
+
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeMigrate()
+
+	current, _, err := currentVersion(m)
+	if err != nil {
+		return fmt.Errorf("failed to get migration version: %w", err)
 	}
 
+	if n < 0 {
+		if err := ignoreNoChange(m.Steps(n)); err != nil {
+			return fmt.Errorf("failed to migrate %d steps: %w", n, err)
+		}
+		return resetDataMigrationsAfterDown(ctx, m, databaseURL)
+	}
+
+	// Data migrations between the steps run in order, so migrate to the version n steps ahead
+	files, err := EmbeddedMigrations()
+	if err != nil {
+		return err
+	}
+	var next []uint
+	for _, file := range files {
+		if file.Version > current {
+			next = append(next, file.Version)
+		}
+	}
+	if len(next) == 0 {
+		return fmt.Errorf("failed to migrate %d steps: %w", n, migrate.ErrShortLimit{Short: uint(n)})
+	}
+	target := next[min(n, len(next))-1]
+
+	err = migrateUp(ctx, m, databaseURL, target, func() error {
+		if err := ignoreNoChange(m.Migrate(target)); err != nil {
+			return err
+		}
+		if len(next) < n {
+			return migrate.ErrShortLimit{Short: uint(n - len(next))}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate %d steps: %w", n, err)
+	}
 	return nil
 }
 
-// GetMigrationVersion returns the current database migration version
-func GetMigrationVersion(ctx context.Context, databaseURL string) (uint, bool, error) {
-	if databaseURL == "" {
-		return 0, false, fmt.Errorf("DATABASE_URL is required")
+// MigrateTo migrates up or down to version
+func MigrateTo(ctx context.Context, databaseURL string, version uint) error {
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
+	if err != nil {
+		return err
 	}
+	defer closeMigrate()
 
-	db, err := sql.Open("pgx", databaseURL)
+	current, _, err := currentVersion(m)
 	if err != nil {
-		return 0, false, fmt.Errorf("failed to open database connection: %w", err)
+		return fmt.Errorf("failed to get migration version: %w", err)
 	}
-	defer db.Close()
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{
-		MigrationsTable: "schema_migrations",
+	if version < current {
+		if err := ignoreNoChange(m.Migrate(version)); err != nil {
+			return fmt.Errorf("failed to migrate to version %d: %w", version, err)
+		}
+		return resetDataMigrationsAfterDown(ctx, m, databaseURL)
+	}
+
+	err = migrateUp(ctx, m, databaseURL, version, func() error {
+		return ignoreNoChange(m.Migrate(version))
 	})
 	if err != nil {
-		return 0, false, fmt.Errorf("failed to create postgres driver: %w", err)
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
 	}
+	return nil
+}
 
-	sourceDriver, err := iofs.New(migrationsFS, "migrations")
+// resetDataMigrationsAfterDown resets the data migrations after the version m was reverted to
+func resetDataMigrationsAfterDown(ctx context.Context, m *migrate.Migrate, databaseURL string) error {
+	version, _, err := currentVersion(m)
 	if err != nil {
-		return 0, false, fmt.Errorf("failed to create source driver: %w", err)
+		return fmt.Errorf("failed to get migration version: %w", err)
 	}
+	return resetDataMigrationsAbove(ctx, databaseURL, version)
+}
 
-	m, err := migrate.NewWithInstance(
-		"iofs",
-		sourceDriver,
-		"postgres",
-		driver,
-	)
+// ForceMigrationVersion records version as applied and clears the dirty flag without running
+// any migration. It is used after repairing a failed migration by hand; -1 means no version.
+func ForceMigrationVersion(ctx context.Context, databaseURL string, version int) error {
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeMigrate()
+
+	if err := m.Force(version); err != nil {
+		return fmt.Errorf("failed to force version %d: %w", version, err)
+	}
+	return nil
+}
+
+// DropDatabase drops every table of the database, including schema_migrations
+func DropDatabase(ctx context.Context, databaseURL string) error {
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer closeMigrate()
+
+	if err := m.Drop(); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+	return nil
+}
+
+// GetMigrationVersion returns the current database migration version
+func GetMigrationVersion(ctx context.Context, databaseURL string) (uint, bool, error) {
+	m, closeMigrate, err := openMigrate(ctx, databaseURL)
 	if err != nil {
-		return 0, false, fmt.Errorf("failed to create migrate instance: %w", err)
+		return 0, false, err
 	}
+	defer closeMigrate()
 
 	version, dirty, err := m.Version()
 	if err == migrate.ErrNilVersion {
@@ -115,16 +440,62 @@ func GetMigrationVersion(ctx context.Context, databaseURL string) (uint, bool, e
 	return version, dirty, nil
 }
 
+// MigrationStatus lists every embedded migration with its state in the database
+func MigrationStatus(ctx context.Context, databaseURL string) ([]MigrationState, error) {
+	files, err := EmbeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := GetMigrationVersion(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(files))
+	for i, file := range files {
+		states[i] = MigrationState{
+			MigrationFile: file,
+			Applied:       file.Version <= version,
+			Dirty:         dirty && file.Version == version,
+		}
+	}
+	return states, nil
+}
+
+// CurrentMigrationVersion reads the migration version through the shared connection pool.
+// Unlike GetMigrationVersion it does not open a new connection, so it is cheap enough for metrics.
+func CurrentMigrationVersion(ctx context.Context) (uint, bool, error) {
+	if DB == nil {
+		return 0, false, fmt.Errorf("database is not initialized")
+	}
+
+	var row struct {
+		Version int64
+		Dirty   bool
+	}
+	// A replica may not have replayed the latest migration yet
+	result := DB.WithContext(ctx).Clauses(dbresolver.Write).Raw("SELECT version, dirty FROM " + migrationsTable + " LIMIT 1").Scan(&row)
+	if result.Error != nil {
+		return 0, false, fmt.Errorf("failed to read schema_migrations: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, false, nil // No migrations applied yet
+	}
+
+	return uint(row.Version), row.Dirty, nil
+}
+
 // ValidateMigrations checks if migrations are in a valid state
 func ValidateMigrations(ctx context.Context, databaseURL string) error {
-	_, dirty, err := GetMigrationVersion(ctx, databaseURL)
+	version, dirty, err := GetMigrationVersion(ctx, databaseURL)
 	if err != nil {
 		return err
 	}
 
 	if dirty {
-		return fmt.Errorf("database is in a dirty migration state - manual intervention required")
+		return fmt.Errorf("database is in a dirty migration state at version %d: %s", version, DirtyHint(version))
 	}
 
-	return nil
+	return validateDataMigrations(DataMigrations())
 }
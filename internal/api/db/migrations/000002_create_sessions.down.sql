@@ -0,0 +1,10 @@
+-- Migration: 000002_create_sessions (DOWN)
+-- Description: Rollback sessions table
+-- WARNING: This will DROP all sessions, every issued token stops working
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+-- Drop table
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,12 @@
+-- Migration: 000003_create_email_change_requests (DOWN)
+-- Description: Rollback email change requests
+-- WARNING: This will DROP all pending email changes
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_email_change_requests_user_id;
+
+-- Drop table
+DROP TABLE IF EXISTS email_change_requests;
+
+-- Drop column
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,20 @@
+-- Migration: 000003_create_email_change_requests
+-- Description: Pending email changes awaiting verification of the new address
+-- Safety: Safe - creates new table and adds a nullable column, no data modification
+
+-- Track when the current email address was last verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Create email_change_requests table with UUID primary key
+CREATE TABLE IF NOT EXISTS email_change_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    confirmed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create indexes for better query performance
+CREATE INDEX IF NOT EXISTS idx_email_change_requests_user_id ON email_change_requests(user_id);
@@ -0,0 +1,10 @@
+-- Migration: 000004_add_user_role_and_status (DOWN)
+-- Description: Rollback user role and status
+-- WARNING: This will DROP role assignments and disabled flags of all users
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_users_status;
+
+-- Drop columns
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
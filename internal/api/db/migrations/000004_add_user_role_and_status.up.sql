@@ -0,0 +1,15 @@
+-- Migration: 000004_add_user_role_and_status
+-- Description: Add role and account status to users for admin management
+-- Safety: Caution - adds columns with defaults, existing users become active with role 'user'.
+-- The status index is built without CONCURRENTLY and blocks writes to users while it builds.
+
+-- Add role and status columns
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(50) DEFAULT 'user' NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(20) DEFAULT 'active' NOT NULL;
+
+-- Create indexes for admin filtering
+-- Building it blocks writes to users for one scan of the table. Where users is large, create it
+-- by hand first with CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_users_status ON users(status),
+-- the statement below then does nothing.
+-- lint:ignore index-not-concurrent already applied by existing deployments, new large ones pre-create it
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
@@ -0,0 +1,10 @@
+-- Migration: 000005_add_user_soft_delete (DOWN)
+-- Description: Rollback user soft delete
+-- WARNING: Soft deleted users become visible again as regular users
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+-- Drop columns
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
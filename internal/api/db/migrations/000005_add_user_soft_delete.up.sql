@@ -0,0 +1,16 @@
+-- Migration: 000005_add_user_soft_delete
+-- Description: Soft delete and anonymization tracking for users
+-- Safety: Caution - adds nullable columns, no data modification. The deleted_at index is built
+-- without CONCURRENTLY and blocks writes to users while it builds.
+
+-- Add soft delete and erasure columns
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP WITH TIME ZONE;
+
+-- Create indexes for better query performance
+-- deleted_at is NULL for every user here, yet the build still scans users and blocks writes
+-- meanwhile. Where users is large, run CREATE INDEX CONCURRENTLY IF NOT EXISTS
+-- idx_users_deleted_at ON users(deleted_at) by hand before upgrading, the statement below is
+-- then skipped.
+-- lint:ignore index-not-concurrent every deleted_at is NULL when this runs, so the index stays tiny
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
@@ -0,0 +1,11 @@
+-- Migration: 000006_create_impersonation_audit_logs (DOWN)
+-- Description: Rollback impersonation audit logs
+-- WARNING: This will DROP the impersonation audit trail
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_impersonation_audit_logs_created_at;
+DROP INDEX IF EXISTS idx_impersonation_audit_logs_subject_id;
+DROP INDEX IF EXISTS idx_impersonation_audit_logs_actor_id;
+
+-- Drop table
+DROP TABLE IF EXISTS impersonation_audit_logs;
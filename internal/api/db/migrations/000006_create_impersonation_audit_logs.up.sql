@@ -0,0 +1,24 @@
+-- Migration: 000006_create_impersonation_audit_logs
+-- Description: Audit trail of support staff impersonating users
+-- Safety: Safe - creates new tables only, no data modification
+
+-- Create impersonation_audit_logs table with UUID primary key
+-- actor_id and subject_id are not foreign keys so the trail survives user deletion
+CREATE TABLE IF NOT EXISTS impersonation_audit_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    actor_id UUID NOT NULL,
+    subject_id UUID NOT NULL,
+    session_id UUID,
+    action VARCHAR(20) NOT NULL,
+    method VARCHAR(10),
+    path VARCHAR(2048),
+    status_code INTEGER,
+    ip_address VARCHAR(45),
+    request_id VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+-- Create indexes for better query performance
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_logs_actor_id ON impersonation_audit_logs(actor_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_logs_subject_id ON impersonation_audit_logs(subject_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_logs_created_at ON impersonation_audit_logs(created_at);
@@ -0,0 +1,6 @@
+-- Migration: 000007_create_data_migrations (DOWN)
+-- Description: Rollback data migrations tracking
+-- WARNING: This will DROP the progress of every data migration, they all run again on the way up
+
+-- Drop table
+DROP TABLE IF EXISTS data_migrations;
@@ -0,0 +1,15 @@
+-- Migration: 000007_create_data_migrations
+-- Description: Progress tracking of the Go data migrations
+-- Safety: Safe - creates a new table only, no data modification
+
+-- Create data_migrations table, one row per registered data migration
+-- IF NOT EXISTS keeps databases where an earlier build created it on first use
+CREATE TABLE IF NOT EXISTS data_migrations (
+    name VARCHAR(255) PRIMARY KEY,
+    after_version BIGINT NOT NULL,
+    cursor TEXT NOT NULL DEFAULT '',
+    rows_done BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,5 @@
+-- Migration: 000008_enable_pg_trgm (DOWN)
+-- Description: Rollback trigram extension
+
+-- Drop extension
+DROP EXTENSION IF EXISTS pg_trgm;
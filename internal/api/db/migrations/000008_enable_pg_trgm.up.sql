@@ -0,0 +1,6 @@
+-- Migration: 000008_enable_pg_trgm
+-- Description: Enable trigram matching for substring searches
+-- Safety: Safe - creates an extension only, no data modification
+
+-- Enable trigram extension, needed by the index of 000009
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
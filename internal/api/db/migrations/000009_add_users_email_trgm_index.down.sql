@@ -0,0 +1,5 @@
+-- Migration: 000009_add_users_email_trgm_index (DOWN)
+-- Description: Rollback email trigram index
+
+-- Drop index
+DROP INDEX CONCURRENTLY IF EXISTS idx_users_email_trgm;
@@ -0,0 +1,7 @@
+-- Migration: 000009_add_users_email_trgm_index
+-- Description: Trigram index for the email_contains filter of the admin user list
+-- Safety: Safe - builds the index concurrently, users stays writable
+
+-- Create index for email ILIKE '%...%', which idx_users_email cannot serve
+-- CONCURRENTLY cannot run in a transaction, so the index is alone in this file
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
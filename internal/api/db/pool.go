@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Statement cache modes of PoolOptions
+const (
+	// StatementCachePrepare prepares each statement once per connection and reuses it
+	StatementCachePrepare = "prepare"
+	// StatementCacheDescribe caches only result descriptions, for schemas changing under the app
+	StatementCacheDescribe = "describe"
+	// StatementCacheNone describes every statement before executing it
+	StatementCacheNone = "none"
+)
+
+// PoolOptions configures the connection pool. Zero values keep the pgx defaults or the
+// parameters of the database URL.
+type PoolOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	ConnectTimeout  time.Duration
+	// ApplicationName is shown in pg_stat_activity
+	ApplicationName string
+	// StatementCacheMode is StatementCachePrepare, StatementCacheDescribe or StatementCacheNone
+	StatementCacheMode string
+	// PgBouncer uses the simple protocol without prepared statements, which PgBouncer requires
+	// in transaction pooling mode. It overrides StatementCacheMode.
+	PgBouncer bool
+}
+
+var (
+	// Pool is the connection pool shared by GORM, the migrations and raw pgx queries
+	Pool *pgxpool.Pool
+
+	// poolURL and poolOptions are those Pool was opened with. Connections to another URL use
+	// the same options.
+	poolURL     string
+	poolOptions PoolOptions
+	poolMu      sync.Mutex
+)
+
+// NewPool opens a connection pool on databaseURL and pings it
+func NewPool(ctx context.Context, databaseURL string, opts PoolOptions) (*pgxpool.Pool, error) {
+	if databaseURL == "" {
+		return nil, fmt.Errorf("DATABASE_URL is required")
+	}
+
+	config, err := newPoolConfig(databaseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return pool, nil
+}
+
+// newPoolConfig parses databaseURL and applies opts
+func newPoolConfig(databaseURL string, opts PoolOptions) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	if err := applyPoolOptions(config, opts); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyPoolOptions sets opts on config
+func applyPoolOptions(config *pgxpool.Config, opts PoolOptions) error {
+	if opts.MaxConns > 0 {
+		config.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		config.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = opts.MaxConnIdleTime
+	}
+
+	conn := config.ConnConfig
+	if opts.ConnectTimeout > 0 {
+		conn.ConnectTimeout = opts.ConnectTimeout
+	}
+	if opts.ApplicationName != "" {
+		conn.RuntimeParams["application_name"] = opts.ApplicationName
+	}
+
+	switch {
+	case opts.PgBouncer:
+		conn.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+		conn.StatementCacheCapacity = 0
+		conn.DescriptionCacheCapacity = 0
+	case opts.StatementCacheMode == StatementCachePrepare:
+		conn.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	case opts.StatementCacheMode == StatementCacheDescribe:
+		conn.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	case opts.StatementCacheMode == StatementCacheNone:
+		conn.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	case opts.StatementCacheMode != "":
+		return fmt.Errorf("unknown statement cache mode %q, expected %s, %s or %s",
+			opts.StatementCacheMode, StatementCachePrepare, StatementCacheDescribe, StatementCacheNone)
+	}
+	return nil
+}
+
+// InitPool opens the shared connection pool. GORM, the migrations and the CLIs connecting to
+// databaseURL afterwards use it instead of opening connections of their own.
+func InitPool(ctx context.Context, databaseURL string, opts PoolOptions) error {
+	pool, err := NewPool(ctx, databaseURL, opts)
+	if err != nil {
+		return err
+	}
+
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if Pool != nil {
+		Pool.Close()
+	}
+	Pool, poolURL, poolOptions = pool, databaseURL, opts
+	return nil
+}
+
+// GetPool returns the shared connection pool, nil before InitPool
+func GetPool() *pgxpool.Pool {
+	return Pool
+}
+
+// ClosePool closes the shared connection pool
+func ClosePool() {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if Pool != nil {
+		Pool.Close()
+		Pool, poolURL = nil, ""
+	}
+}
+
+// openSQL returns a database/sql handle on the shared pool when it is open on databaseURL, or
+// on a pool of its own otherwise. closeSQL must be called to release it, which leaves the
+// shared pool open.
+func openSQL(ctx context.Context, databaseURL string) (sqlDB *sql.DB, closeSQL func(), err error) {
+	poolMu.Lock()
+	pool, opts := Pool, poolOptions
+	shared := pool != nil && poolURL == databaseURL
+	poolMu.Unlock()
+
+	if !shared {
+		if pool, err = NewPool(ctx, databaseURL, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sqlDB = stdlib.OpenDBFromPool(pool)
+	return sqlDB, func() {
+		sqlDB.Close()
+		if !shared {
+			pool.Close()
+		}
+	}, nil
+}
@@ -1,71 +1,87 @@
 package db
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
 )
 
 // ConnectionPoolStats represents database connection pool statistics
 type ConnectionPoolStats struct {
-	MaxOpenConnections int    // Maximum number of open connections
-	OpenConnections    int    // Number of open connections (in use + idle)
-	InUse              int    // Number of connections currently in use
-	Idle               int    // Number of idle connections
-	WaitCount          int64  // Total number of connections waited for
-	WaitDuration       string // Total time blocked waiting for a new connection
-	MaxIdleClosed      int64  // Total number of connections closed due to SetMaxIdleConns
-	MaxIdleTimeClosed  int64  // Total number of connections closed due to SetConnMaxIdleTime
-	MaxLifetimeClosed  int64  // Total number of connections closed due to SetConnMaxLifetime
+	MaxConns                int32  // Maximum number of connections
+	TotalConns              int32  // Number of connections (in use + idle + being established)
+	AcquiredConns           int32  // Number of connections currently in use
+	IdleConns               int32  // Number of idle connections
+	ConstructingConns       int32  // Number of connections being established
+	AcquireCount            int64  // Total number of connections acquired
+	EmptyAcquireCount       int64  // Total number of acquires that waited for a connection
+	EmptyAcquireWaitTime    string // Total time waited for a connection
+	CanceledAcquireCount    int64  // Total number of acquires cancelled while waiting
+	MaxIdleDestroyCount     int64  // Total number of connections closed due to MaxConnIdleTime
+	MaxLifetimeDestroyCount int64  // Total number of connections closed due to MaxConnLifetime
 }
 
-// GetPoolStats returns connection pool statistics
-// This is useful for monitoring and verifying connection reuse
-func GetPoolStats() (*ConnectionPoolStats, error) {
-	if DB == nil {
+// GetPoolStat returns the raw statistics of the shared pgx pool
+func GetPoolStat() (*pgxpool.Stat, error) {
+	pool := GetPool()
+	if pool == nil {
 		return nil, fmt.Errorf("database is not initialized")
 	}
+	return pool.Stat(), nil
+}
 
-	sqlDB, err := DB.DB()
+// GetPoolStats returns connection pool statistics
+// This is useful for monitoring and verifying connection reuse
+func GetPoolStats() (*ConnectionPoolStats, error) {
+	stat, err := GetPoolStat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+		return nil, err
 	}
+	return poolStats(stat), nil
+}
 
-	stats := sqlDB.Stats()
-
+func poolStats(stat *pgxpool.Stat) *ConnectionPoolStats {
 	return &ConnectionPoolStats{
-		MaxOpenConnections: stats.MaxOpenConnections,
-		OpenConnections:    stats.OpenConnections,
-		InUse:              stats.InUse,
-		Idle:               stats.Idle,
-		WaitCount:          stats.WaitCount,
-		WaitDuration:       stats.WaitDuration.String(),
-		MaxIdleClosed:      stats.MaxIdleClosed,
-		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
-		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
-	}, nil
+		MaxConns:                stat.MaxConns(),
+		TotalConns:              stat.TotalConns(),
+		AcquiredConns:           stat.AcquiredConns(),
+		IdleConns:               stat.IdleConns(),
+		ConstructingConns:       stat.ConstructingConns(),
+		AcquireCount:            stat.AcquireCount(),
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		EmptyAcquireWaitTime:    stat.EmptyAcquireWaitTime().String(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+	}
 }
 
-func LogPoolStats() error {
+// LogPoolStats logs the statistics of the shared pool through the logger of ctx
+func LogPoolStats(ctx context.Context) error {
 	stats, err := GetPoolStats()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Database Connection Pool Stats:\n")
-	fmt.Printf("  Max Open Connections: %d\n", stats.MaxOpenConnections)
-	fmt.Printf("  Open Connections: %d\n", stats.OpenConnections)
-	fmt.Printf("  In Use: %d\n", stats.InUse)
-	fmt.Printf("  Idle: %d\n", stats.Idle)
-	fmt.Printf("  Wait Count: %d\n", stats.WaitCount)
-	fmt.Printf("  Wait Duration: %s\n", stats.WaitDuration)
-	fmt.Printf("  Max Idle Closed: %d\n", stats.MaxIdleClosed)
-	fmt.Printf("  Max Idle Time Closed: %d\n", stats.MaxIdleTimeClosed)
-	fmt.Printf("  Max Lifetime Closed: %d\n", stats.MaxLifetimeClosed)
+	zerolog.Ctx(ctx).Info().
+		Int32("max_conns", stats.MaxConns).
+		Int32("total_conns", stats.TotalConns).
+		Int32("acquired_conns", stats.AcquiredConns).
+		Int32("idle_conns", stats.IdleConns).
+		Int64("acquire_count", stats.AcquireCount).
+		Int64("empty_acquire_count", stats.EmptyAcquireCount).
+		Str("empty_acquire_wait_time", stats.EmptyAcquireWaitTime).
+		Int64("max_idle_destroy_count", stats.MaxIdleDestroyCount).
+		Int64("max_lifetime_destroy_count", stats.MaxLifetimeDestroyCount).
+		Msg("Database connection pool stats")
 
 	return nil
 }
 
 // VerifyConnectionReuse verifies that connections are being reused properly
-// Returns true if connections are being reused (idle connections > 0 or in use < open)
+// Returns true if connections are being reused (idle connections > 0 or acquires outnumber connections)
 func VerifyConnectionReuse() (bool, error) {
 	stats, err := GetPoolStats()
 	if err != nil {
@@ -74,8 +90,8 @@ func VerifyConnectionReuse() (bool, error) {
 
 	// Connections are being reused if:
 	// 1. There are idle connections (connections available for reuse)
-	// 2. Or connections are being used but pool is working (open < max)
-	reusing := stats.Idle > 0 || (stats.OpenConnections < stats.MaxOpenConnections && stats.OpenConnections > 0)
+	// 2. Or more connections were acquired than the pool has established
+	reusing := stats.IdleConns > 0 || (stats.TotalConns > 0 && stats.AcquireCount > int64(stats.TotalConns))
 
 	return reusing, nil
 }
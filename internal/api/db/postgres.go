@@ -4,12 +4,22 @@ import (
 	"context"
 )
 
-func InitPostgres(ctx context.Context, databaseURL string) error {
-	return InitGORM(ctx, databaseURL)
+// InitPostgres opens the shared connection pool and initializes GORM on it
+func InitPostgres(ctx context.Context, databaseURL string, poolOpts PoolOptions, opts QueryLogOptions) error {
+	if err := InitPool(ctx, databaseURL, poolOpts); err != nil {
+		return err
+	}
+	if err := InitGORM(ctx, databaseURL, opts); err != nil {
+		ClosePool()
+		return err
+	}
+	return nil
 }
 
 func ClosePostgres() error {
-	return CloseGORM()
+	err := CloseGORM()
+	ClosePool()
+	return err
 }
 
 func HealthCheck(ctx context.Context) error {
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	applogger "go-boilerplate-api/internal/api/logger"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// QueryLogOptions configures SQL logging and per-request query statistics
+type QueryLogOptions struct {
+	// SlowThreshold logs queries taking longer as warnings, 0 disables slow query logging
+	SlowThreshold time.Duration
+	// LogParams interpolates parameter values into logged SQL. When false, every value is
+	// logged as [REDACTED] so user data does not reach the logs.
+	LogParams bool
+	// NPlusOneThreshold warns when one statement shape runs this many times in a request,
+	// 0 disables the detector
+	NPlusOneThreshold int
+}
+
+// queryLogger is a GORM logger writing to the zerolog logger of the statement context,
+// so queries run with c.UserContext() carry the request ID.
+// Every query is logged at debug level, slow queries as warnings and failures as errors.
+type queryLogger struct {
+	level logger.LogLevel
+	opts  QueryLogOptions
+}
+
+var (
+	_ logger.Interface  = (*queryLogger)(nil)
+	_ gorm.ParamsFilter = (*queryLogger)(nil)
+)
+
+func newQueryLogger(opts QueryLogOptions) *queryLogger {
+	return &queryLogger{level: logger.Info, opts: opts}
+}
+
+// LogMode returns a copy logging at level, used by db.Debug() and Session(&gorm.Session{Logger: ...})
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	next := *l
+	next.level = level
+	return &next
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		zerolog.Ctx(ctx).Info().Str("caller", queryCaller()).Msgf(msg, data...)
+	}
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		zerolog.Ctx(ctx).Warn().Str("caller", queryCaller()).Msgf(msg, data...)
+	}
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		zerolog.Ctx(ctx).Error().Str("caller", queryCaller()).Msgf(msg, data...)
+	}
+}
+
+// Trace logs a finished statement. fc renders the SQL and is only called when a line is written.
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	log := zerolog.Ctx(ctx)
+
+	var event *zerolog.Event
+	message := "SQL query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		event = log.Error().Err(err)
+		message = "SQL query failed"
+	case l.opts.SlowThreshold > 0 && elapsed > l.opts.SlowThreshold && l.level >= logger.Warn:
+		event = log.Warn().Dur("threshold", l.opts.SlowThreshold)
+		message = fmt.Sprintf("Slow SQL query (over %s)", l.opts.SlowThreshold)
+	case l.level >= logger.Info:
+		event = log.Debug()
+	}
+	if event == nil || !event.Enabled() {
+		return
+	}
+
+	sql, rows := fc()
+	event = event.Str("sql", sql).Dur("elapsed", elapsed).Str("caller", queryCaller())
+	if rows >= 0 {
+		event = event.Int64("rows", rows)
+	}
+	event.Msg(message)
+}
+
+// ParamsFilter replaces the parameter values with logger.Redacted in the logged SQL unless LogParams is set
+func (l *queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.opts.LogParams {
+		return sql, params
+	}
+	redacted := make([]interface{}, len(params))
+	for i := range redacted {
+		redacted[i] = applogger.Redacted
+	}
+	return sql, redacted
+}
+
+// queryCaller returns the file and line of the application code that ran the statement,
+// skipping GORM, its plugins and this logger
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.File, "/gorm.io/") &&
+			!strings.HasSuffix(frame.File, "/db/querylog.go") &&
+			!strings.HasSuffix(frame.File, "/db/querystats.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
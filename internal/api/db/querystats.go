@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// QueryStats counts the statements run with a context, usually one per HTTP request
+type QueryStats struct {
+	mu       sync.Mutex
+	count    int
+	duration time.Duration
+	shapes   map[string]int
+}
+
+// Count returns the number of statements run
+func (s *QueryStats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Duration returns the time spent running statements
+func (s *QueryStats) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duration
+}
+
+// record adds a statement and returns how many times its shape ran so far
+func (s *QueryStats) record(shape string, elapsed time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.duration += elapsed
+	s.shapes[shape]++
+	return s.shapes[shape]
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context collecting the statistics of the statements run with it
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{shapes: map[string]int{}}
+	return context.WithValue(ctx, queryStatsKey{}, stats), stats
+}
+
+// QueryStatsFromContext returns the statistics collected for ctx, or nil
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return stats
+}
+
+// queryStatsStartKey is the statement setting holding the start time of a statement
+const queryStatsStartKey = "query_stats:start"
+
+// queryStatsPlugin records every statement in the QueryStats of its context and warns
+// when one statement shape, the SQL with placeholders, runs nPlusOneThreshold times,
+// which usually means a query in a loop that should be a join or a preload
+type queryStatsPlugin struct {
+	nPlusOneThreshold int
+}
+
+func (p *queryStatsPlugin) Name() string {
+	return "query_stats"
+}
+
+func (p *queryStatsPlugin) Initialize(db *gorm.DB) error {
+	type registerFunc = func(name string, fn func(*gorm.DB)) error
+
+	callbacks := db.Callback()
+	hooks := []struct{ before, after registerFunc }{
+		{callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+
+	for _, hook := range hooks {
+		if err := hook.before("query_stats:before", p.before); err != nil {
+			return err
+		}
+		if err := hook.after("query_stats:after", p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *queryStatsPlugin) before(db *gorm.DB) {
+	if QueryStatsFromContext(db.Statement.Context) != nil {
+		db.InstanceSet(queryStatsStartKey, time.Now())
+	}
+}
+
+func (p *queryStatsPlugin) after(db *gorm.DB) {
+	ctx := db.Statement.Context
+	stats := QueryStatsFromContext(ctx)
+	if stats == nil {
+		return
+	}
+
+	var elapsed time.Duration
+	if start, ok := db.InstanceGet(queryStatsStartKey); ok {
+		elapsed = time.Since(start.(time.Time))
+	}
+
+	shape := db.Statement.SQL.String()
+	if shape == "" {
+		return // nothing was executed, e.g. a callback aborted the statement
+	}
+
+	if runs := stats.record(shape, elapsed); p.nPlusOneThreshold > 0 && runs == p.nPlusOneThreshold {
+		zerolog.Ctx(ctx).Warn().
+			Str("sql", shape).
+			Int("runs", runs).
+			Str("caller", queryCaller()).
+			Msg("Possible N+1 query: the same statement ran repeatedly in one request")
+	}
+}
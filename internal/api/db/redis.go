@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -33,6 +34,11 @@ func InitRedis(ctx context.Context, redisURL string) error {
 	// Create Redis client
 	RedisClient = redis.NewClient(opt)
 
+	// Trace commands as children of the span in the command context
+	if err := redisotel.InstrumentTracing(RedisClient, redisotel.WithDBStatement(false)); err != nil {
+		return fmt.Errorf("failed to instrument Redis tracing: %w", err)
+	}
+
 	// Verify the connection by pinging Redis
 	err = RedisClient.Ping(ctx).Err()
 	if err != nil {
@@ -0,0 +1,477 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// ReplicaOptions configures the read replicas
+type ReplicaOptions struct {
+	// Pool configures the pool of each replica
+	Pool PoolOptions
+	// HealthInterval is how often each replica is checked, 5s when zero
+	HealthInterval time.Duration
+	// MaxLag is the replication lag past which a replica stops receiving reads, 0 for no limit
+	MaxLag time.Duration
+}
+
+// ReplicaState is the health and pool statistics of a read replica
+type ReplicaState struct {
+	// Name is the host and port of the replica, its URL is not shown as it holds credentials
+	Name    string
+	Healthy bool
+	Error   string
+	// Lag is the replication lag measured by the last successful check
+	Lag       time.Duration
+	CheckedAt time.Time
+	Pool      *ConnectionPoolStats
+}
+
+// replica is a read replica and the outcome of its last health check
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	sqlDB   *sql.DB
+	maxLag  time.Duration
+	healthy atomic.Bool
+
+	mu        sync.Mutex
+	lastErr   error
+	lag       time.Duration
+	checkedAt time.Time
+}
+
+var (
+	// replicas are the read replicas DB routes reads to, empty without DATABASE_REPLICA_URLS
+	replicas []*replica
+
+	stopReplicaChecks context.CancelFunc
+	replicaChecks     sync.WaitGroup
+)
+
+// InitReplicas opens a pool per replica URL and routes the reads of DB to the healthy ones,
+// round robin. A replica is healthy when it answers, is in recovery and lags at most
+// opts.MaxLag behind the primary. Writes, transactions and locking reads go to the primary, and so do all reads
+// when no replica is healthy. It must be called after InitGORM.
+// Replicas down at startup do not fail it, they are used once their health check passes.
+func InitReplicas(ctx context.Context, urls []string, opts ReplicaOptions) error {
+	if DB == nil {
+		return fmt.Errorf("database is not initialized")
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	interval := opts.HealthInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	var opened []*replica
+	closeOpened := func() {
+		for _, r := range opened {
+			r.sqlDB.Close()
+			r.pool.Close()
+		}
+	}
+	dialectors := make([]gorm.Dialector, 0, len(urls))
+	for i, url := range urls {
+		config, err := newPoolConfig(url, opts.Pool)
+		if err != nil {
+			closeOpened()
+			return fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		// Connections are established lazily, so a replica that is down does not block startup
+		pool, err := pgxpool.NewWithConfig(ctx, config)
+		if err != nil {
+			closeOpened()
+			return fmt.Errorf("replica %d: failed to create connection pool: %w", i+1, err)
+		}
+
+		r := &replica{
+			name:   fmt.Sprintf("%s:%d", config.ConnConfig.Host, config.ConnConfig.Port),
+			pool:   pool,
+			sqlDB:  stdlib.OpenDBFromPool(pool),
+			maxLag: opts.MaxLag,
+		}
+		opened = append(opened, r)
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: r.sqlDB}))
+	}
+
+	// Check every replica once so reads start on the healthy ones
+	for _, r := range opened {
+		r.check(ctx, interval)
+		if !r.healthy.Load() {
+			zerolog.Ctx(ctx).Warn().Err(r.lastErr).Str("replica", r.name).Msg("Read replica is unhealthy, reads go elsewhere until it recovers")
+		}
+	}
+
+	err := DB.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   &healthyReplicaPolicy{},
+	}))
+	if err != nil {
+		closeOpened()
+		return fmt.Errorf("failed to register read replicas: %w", err)
+	}
+	if err := DB.Use(&replicaRoutingPlugin{}); err != nil {
+		closeOpened()
+		return fmt.Errorf("failed to register replica routing: %w", err)
+	}
+	replicas = opened
+
+	// The health checks outlive ctx but keep its logger
+	checkCtx, cancel := context.WithCancel(zerolog.Ctx(ctx).WithContext(context.Background()))
+	stopReplicaChecks = cancel
+	replicaChecks.Add(1)
+	go func() {
+		defer replicaChecks.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-checkCtx.Done():
+				return
+			case <-ticker.C:
+				for _, r := range replicas {
+					r.check(checkCtx, interval)
+				}
+			}
+		}
+	}()
+
+	zerolog.Ctx(ctx).Info().Int("replicas", len(opened)).Int("healthy", healthyReplicaCount()).Msg("Read replicas enabled")
+	return nil
+}
+
+// CloseReplicas stops the health checks and closes the replica pools. Reads go to the
+// primary afterwards.
+func CloseReplicas() {
+	if stopReplicaChecks != nil {
+		stopReplicaChecks()
+		replicaChecks.Wait()
+		stopReplicaChecks = nil
+	}
+	for _, r := range replicas {
+		r.healthy.Store(false)
+		r.sqlDB.Close()
+		r.pool.Close()
+	}
+}
+
+// replicaLagQuery reports whether the server is a replica and how far its replay is behind.
+// A replica that replayed all it received is not lagging, however old its last transaction,
+// as the primary may just be idle.
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(),
+		CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8`
+
+// check queries the recovery state and lag of the replica and logs when its health changes
+func (r *replica) check(ctx context.Context, timeout time.Duration) {
+	queryCtx, cancel := context.WithTimeout(ctx, timeout)
+	var (
+		inRecovery bool
+		lagSeconds float64
+	)
+	err := r.pool.QueryRow(queryCtx, replicaLagQuery).Scan(&inRecovery, &lagSeconds)
+	cancel()
+	if ctx.Err() != nil {
+		return // shutting down
+	}
+
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	switch {
+	case err != nil:
+	case !inRecovery:
+		// A promoted replica takes writes the primary does not have
+		err = fmt.Errorf("server is not in recovery, it is not a replica of the primary")
+	case r.maxLag > 0 && lag > r.maxLag:
+		err = fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), r.maxLag)
+	}
+
+	r.mu.Lock()
+	r.lastErr, r.checkedAt = err, time.Now()
+	if inRecovery {
+		r.lag = lag
+	}
+	r.mu.Unlock()
+
+	healthy := err == nil
+	if was := r.healthy.Swap(healthy); was == healthy {
+		return
+	}
+	if healthy {
+		zerolog.Ctx(ctx).Info().Str("replica", r.name).Msg("Read replica is healthy, routing reads to it")
+	} else {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("replica", r.name).Dur("lag", lag).Int("healthy_replicas", healthyReplicaCount()).
+			Msg("Read replica is unhealthy, routing its reads elsewhere")
+	}
+}
+
+// HasReplicas reports whether read replicas are configured
+func HasReplicas() bool {
+	return len(replicas) > 0
+}
+
+// ReplicaStatus returns the state of every read replica
+func ReplicaStatus() []ReplicaState {
+	states := make([]ReplicaState, len(replicas))
+	for i, r := range replicas {
+		r.mu.Lock()
+		states[i] = ReplicaState{
+			Name:      r.name,
+			Healthy:   r.healthy.Load(),
+			Lag:       r.lag,
+			CheckedAt: r.checkedAt,
+			Pool:      poolStats(r.pool.Stat()),
+		}
+		if r.lastErr != nil {
+			states[i].Error = r.lastErr.Error()
+		}
+		r.mu.Unlock()
+	}
+	return states
+}
+
+func healthyReplicaCount() int {
+	n := 0
+	for _, r := range replicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// healthyReplicaPolicy balances reads round robin over the healthy replicas. dbresolver only
+// consults it with several replicas, replicaRoutingPlugin covers a single unhealthy one.
+type healthyReplicaPolicy struct {
+	next atomic.Uint64
+}
+
+func (p *healthyReplicaPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	start := p.next.Add(1)
+	for i := range connPools {
+		pool := connPools[(start+uint64(i))%uint64(len(connPools))]
+		if r := replicaOf(pool); r == nil || r.healthy.Load() {
+			return pool
+		}
+	}
+	// None is healthy, fall back to the primary
+	return DB.Config.ConnPool
+}
+
+// replicaOf returns the replica whose connection pool is pool
+func replicaOf(pool gorm.ConnPool) *replica {
+	for _, r := range replicas {
+		if pool == gorm.ConnPool(r.sqlDB) {
+			return r
+		}
+	}
+	return nil
+}
+
+// replicaRoutingPlugin sends reads to the primary when no replica is healthy or the context
+// wrote recently, and records the writes of contexts tracking them
+type replicaRoutingPlugin struct{}
+
+func (p *replicaRoutingPlugin) Name() string {
+	return "replica_routing"
+}
+
+func (p *replicaRoutingPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	// Registered after dbresolver, the read hook runs before its gorm:db_resolver callback, as
+	// GORM runs the last registered Before("*") callback first
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		callbacks.Query().Before("*").Register,
+		callbacks.Row().Before("*").Register,
+		callbacks.Raw().Before("*").Register,
+	} {
+		if err := register("replica_routing:read", p.read); err != nil {
+			return err
+		}
+	}
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		callbacks.Create().After("*").Register,
+		callbacks.Update().After("*").Register,
+		callbacks.Delete().After("*").Register,
+		callbacks.Raw().After("*").Register,
+	} {
+		if err := register("replica_routing:write", p.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *replicaRoutingPlugin) read(db *gorm.DB) {
+	if healthyReplicaCount() == 0 || ReadYourWritesFromContext(db.Statement.Context).Sticky() {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+func (p *replicaRoutingPlugin) write(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	// Raw runs Exec, which is a write unless it is a SELECT
+	if sql := strings.TrimSpace(db.Statement.SQL.String()); len(sql) >= 6 && strings.EqualFold(sql[:6], "select") {
+		return
+	}
+	ReadYourWritesFromContext(db.Statement.Context).recordWrite()
+}
+
+// ReadYourWrites routes the reads of a context to the primary for a window after its last
+// write, so a request reads what it wrote despite replication lag. Bound to a key with Resume,
+// the deadline is shared by the requests of that key, on every instance when Redis is
+// configured.
+type ReadYourWrites struct {
+	window  time.Duration
+	until   atomic.Int64 // Unix nanoseconds
+	key     string
+	resumed int64
+}
+
+type readYourWritesKey struct{}
+
+// readPrimaryKeyPrefix prefixes the Redis keys holding until when the reads of a key go to
+// the primary
+const readPrimaryKeyPrefix = "read_primary_until:"
+
+// stickyDeadlines holds the deadlines of keys without Redis, by key
+var stickyDeadlines = &stickyStore{until: map[string]time.Time{}}
+
+// WithReadYourWrites returns a context whose reads go to the primary for window after a write
+func WithReadYourWrites(ctx context.Context, window time.Duration) (context.Context, *ReadYourWrites) {
+	r := &ReadYourWrites{window: window}
+	return context.WithValue(ctx, readYourWritesKey{}, r), r
+}
+
+// WithoutReadYourWrites returns a context whose writes are not tracked, for bookkeeping such
+// as session activity that later reads of the request do not depend on
+func WithoutReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, (*ReadYourWrites)(nil))
+}
+
+// ReadYourWritesFromContext returns the tracker of ctx, or nil
+func ReadYourWritesFromContext(ctx context.Context) *ReadYourWrites {
+	r, _ := ctx.Value(readYourWritesKey{}).(*ReadYourWrites)
+	return r
+}
+
+// Resume binds the tracker to key, such as the authenticated user, so reads go to the primary
+// while a write recorded by Save for the same key is within the window. A store failure is
+// logged and leaves the reads on the replicas.
+func (r *ReadYourWrites) Resume(ctx context.Context, key string) {
+	if r == nil || r.window <= 0 || key == "" {
+		return
+	}
+	r.key = key
+
+	var until time.Time
+	if rdb := GetRedis(); rdb != nil {
+		ms, err := rdb.Get(ctx, readPrimaryKeyPrefix+key).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to read the read-your-writes deadline, reading from the replicas")
+			return
+		}
+		if err == nil {
+			until = time.UnixMilli(ms)
+		}
+	} else {
+		until = stickyDeadlines.get(key)
+	}
+
+	if until.After(time.Now()) && until.UnixNano() > r.until.Load() {
+		r.until.Store(until.UnixNano())
+	}
+	r.resumed = r.until.Load()
+}
+
+// Save records the deadline of the tracker's writes for the later requests of its key. It does
+// nothing when the tracker has no key or did not write since Resume.
+func (r *ReadYourWrites) Save(ctx context.Context) {
+	if r == nil || r.key == "" {
+		return
+	}
+	until := r.Until()
+	if until.IsZero() || until.UnixNano() == r.resumed {
+		return
+	}
+
+	if rdb := GetRedis(); rdb != nil {
+		if err := rdb.Set(ctx, readPrimaryKeyPrefix+r.key, until.UnixMilli(), time.Until(until)).Err(); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to save the read-your-writes deadline")
+		}
+		return
+	}
+	stickyDeadlines.set(r.key, until)
+}
+
+// Until returns when reads may go to the replicas again, zero when they already do
+func (r *ReadYourWrites) Until() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	until := time.Unix(0, r.until.Load())
+	if !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// Sticky reports whether reads go to the primary
+func (r *ReadYourWrites) Sticky() bool {
+	return !r.Until().IsZero()
+}
+
+func (r *ReadYourWrites) recordWrite() {
+	if r != nil && r.window > 0 {
+		r.until.Store(time.Now().Add(r.window).UnixNano())
+	}
+}
+
+// stickyStore keeps read-your-writes deadlines in memory, for a single instance without Redis
+type stickyStore struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	swept time.Time
+}
+
+func (s *stickyStore) get(key string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.until[key]
+}
+
+// set stores the deadline of key, dropping the expired ones at most once a minute
+func (s *stickyStore) set(key string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.swept) >= time.Minute {
+		for k, deadline := range s.until {
+			if !deadline.After(now) {
+				delete(s.until, k)
+			}
+		}
+		s.swept = now
+	}
+	s.until[key] = until
+}
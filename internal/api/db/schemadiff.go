@@ -0,0 +1,487 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Kinds of differences between the GORM models and the database
+const (
+	DiffMissingTable  = "missing-table"
+	DiffMissingColumn = "missing-column"
+	DiffExtraColumn   = "extra-column"
+	DiffTypeMismatch  = "type-mismatch"
+	DiffNullability   = "nullability"
+	DiffMissingIndex  = "missing-index"
+)
+
+// SchemaDifference is a disagreement between a GORM model and the live schema
+type SchemaDifference struct {
+	Kind   string
+	Table  string
+	Column string
+	// Model and Database describe each side, e.g. varchar(255) and text
+	Model    string
+	Database string
+	// Up and Down are draft SQL resolving the difference and reverting that, to be reviewed
+	Up   string
+	Down string
+}
+
+func (d SchemaDifference) String() string {
+	target := d.Table
+	if d.Column != "" {
+		target += "." + d.Column
+	}
+	return fmt.Sprintf("%s: [%s] model: %s, database: %s", target, d.Kind, d.Model, d.Database)
+}
+
+// liveColumn is a column of the database
+type liveColumn struct {
+	Type     string
+	Nullable bool
+}
+
+// liveIndex is an index of the database, with its columns in order
+type liveIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Primary bool
+}
+
+// liveTable is a table of the database, nil when it does not exist
+type liveTable struct {
+	Columns map[string]liveColumn
+	Indexes []liveIndex
+}
+
+// DiffSchema compares models with the tables of the current schema of the database and
+// returns the differences, ordered by model and column
+func DiffSchema(ctx context.Context, databaseURL string, models []any) ([]SchemaDifference, error) {
+	gormDB, closeDB, err := openDataDB(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB()
+
+	cache := &sync.Map{}
+	var diffs []SchemaDifference
+	for _, model := range models {
+		sch, err := schema.Parse(model, cache, gormDB.NamingStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+
+		live, err := inspectTable(gormDB, sch.Table)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, compareModel(gormDB.Dialector, sch, live)...)
+	}
+	return diffs, nil
+}
+
+// inspectTable reads the columns and indexes of table, nil when it does not exist
+func inspectTable(gormDB *gorm.DB, table string) (*liveTable, error) {
+	var columns []struct {
+		ColumnName             string
+		DataType               string
+		UdtName                string
+		CharacterMaximumLength sql.NullInt64
+		NumericPrecision       sql.NullInt64
+		NumericScale           sql.NullInt64
+		IsNullable             string
+	}
+	err := gormDB.Raw(`
+		SELECT column_name, data_type, udt_name, character_maximum_length, numeric_precision, numeric_scale, is_nullable
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?
+		ORDER BY ordinal_position`, table).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	live := &liveTable{Columns: map[string]liveColumn{}}
+	for _, column := range columns {
+		dataType := column.DataType
+		switch {
+		case dataType == "USER-DEFINED" || dataType == "ARRAY":
+			dataType = column.UdtName
+		case column.CharacterMaximumLength.Valid:
+			dataType = fmt.Sprintf("%s(%d)", dataType, column.CharacterMaximumLength.Int64)
+		case dataType == "numeric" && column.NumericPrecision.Valid:
+			dataType = fmt.Sprintf("numeric(%d,%d)", column.NumericPrecision.Int64, column.NumericScale.Int64)
+		}
+		live.Columns[column.ColumnName] = liveColumn{Type: canonicalType(dataType), Nullable: column.IsNullable == "YES"}
+	}
+
+	var indexes []struct {
+		Name      string
+		IsUnique  bool
+		IsPrimary bool
+		Columns   string
+	}
+	err = gormDB.Raw(`
+		SELECT i.relname AS name, ix.indisunique AS is_unique, ix.indisprimary AS is_primary,
+			string_agg(COALESCE(a.attname, '<expression>'), ',' ORDER BY k.ord) AS columns
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = current_schema() AND t.relname = ?
+		GROUP BY i.relname, ix.indisunique, ix.indisprimary`, table).Scan(&indexes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes of %s: %w", table, err)
+	}
+	for _, index := range indexes {
+		live.Indexes = append(live.Indexes, liveIndex{
+			Name:    index.Name,
+			Columns: strings.Split(index.Columns, ","),
+			Unique:  index.IsUnique,
+			Primary: index.IsPrimary,
+		})
+	}
+	return live, nil
+}
+
+// compareModel lists the differences between the parsed model and its live table
+func compareModel(dialector gorm.Dialector, sch *schema.Schema, live *liveTable) []SchemaDifference {
+	table := sch.Table
+	fields := modelFields(sch)
+
+	if live == nil {
+		return []SchemaDifference{{
+			Kind: DiffMissingTable, Table: table,
+			Model: fmt.Sprintf("%d columns", len(fields)), Database: "missing",
+			Up:   createTableSQL(dialector, sch),
+			Down: fmt.Sprintf("DROP TABLE IF EXISTS %s;", table),
+		}}
+	}
+
+	var diffs []SchemaDifference
+	known := map[string]bool{}
+	for _, field := range fields {
+		column := field.DBName
+		known[column] = true
+		modelType := canonicalType(dialector.DataTypeOf(field))
+		notNull := field.NotNull || field.PrimaryKey
+
+		actual, ok := live.Columns[column]
+		if !ok {
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffMissingColumn, Table: table, Column: column,
+				Model: modelType, Database: "missing",
+				Up:   addColumnSQL(dialector, table, field),
+				Down: fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s;", table, column),
+			})
+			continue
+		}
+
+		if actual.Type != modelType {
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffTypeMismatch, Table: table, Column: column,
+				Model: modelType, Database: actual.Type,
+				Up: fmt.Sprintf("-- Review: rewrites the table and fails if existing values do not convert\n"+
+					"ALTER TABLE %s ALTER COLUMN %s TYPE %s;", table, column, modelType),
+				Down: fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s;", table, column, actual.Type),
+			})
+		}
+
+		// A NOT NULL column only conflicts with fields that can hold NULL, other Go values
+		// are never written as NULL
+		switch {
+		case notNull && actual.Nullable:
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffNullability, Table: table, Column: column,
+				Model: "NOT NULL", Database: "NULL",
+				Up: fmt.Sprintf("-- Review: fails while rows hold NULL, backfill them first\n"+
+					"ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, column),
+				Down: fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL;", table, column),
+			})
+		case !notNull && !actual.Nullable && nullableField(field):
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffNullability, Table: table, Column: column,
+				Model: "NULL", Database: "NOT NULL",
+				Up: fmt.Sprintf("-- Review: or make %s.%s non-nullable in the model\n"+
+					"ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL;", sch.Name, field.Name, table, column),
+				Down: fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, column),
+			})
+		}
+	}
+
+	for column, actual := range live.Columns {
+		if !known[column] {
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffExtraColumn, Table: table, Column: column,
+				Model: "missing", Database: actual.Type,
+				Up: fmt.Sprintf("-- %s.%s is not in the model: add it to %s, or drop it once no release uses it", table, column, sch.Name),
+			})
+		}
+	}
+
+	for _, index := range modelIndexes(sch) {
+		if !hasIndex(live.Indexes, index) {
+			down := fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s;", index.Name)
+			if index.Primary {
+				down = fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", table, index.Name)
+			}
+			diffs = append(diffs, SchemaDifference{
+				Kind: DiffMissingIndex, Table: table, Column: strings.Join(index.Columns, ","),
+				Model: describeIndex(index), Database: "missing",
+				Up:   createIndexSQL(table, index),
+				Down: down,
+			})
+		}
+	}
+
+	sortDifferences(diffs, fields)
+	return diffs
+}
+
+// modelFields returns the fields of sch stored in the database
+func modelFields(sch *schema.Schema) []*schema.Field {
+	var fields []*schema.Field
+	for _, field := range sch.Fields {
+		if field.DBName != "" && !field.IgnoreMigration {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+var (
+	nullableTypes = map[reflect.Type]bool{
+		reflect.TypeOf(gorm.DeletedAt{}):  true,
+		reflect.TypeOf(sql.NullString{}):  true,
+		reflect.TypeOf(sql.NullInt64{}):   true,
+		reflect.TypeOf(sql.NullInt32{}):   true,
+		reflect.TypeOf(sql.NullBool{}):    true,
+		reflect.TypeOf(sql.NullFloat64{}): true,
+		reflect.TypeOf(sql.NullTime{}):    true,
+	}
+)
+
+// nullableField reports whether the field can be written as NULL
+func nullableField(field *schema.Field) bool {
+	return field.FieldType.Kind() == reflect.Ptr || nullableTypes[field.FieldType]
+}
+
+// modelIndexes returns the indexes the model declares: its primary key, unique columns and
+// index/uniqueIndex tags
+func modelIndexes(sch *schema.Schema) []liveIndex {
+	var indexes []liveIndex
+	if len(sch.PrimaryFieldDBNames) > 0 {
+		indexes = append(indexes, liveIndex{Name: sch.Table + "_pkey", Columns: sch.PrimaryFieldDBNames, Unique: true, Primary: true})
+	}
+	for _, field := range modelFields(sch) {
+		if field.Unique {
+			indexes = append(indexes, liveIndex{Name: sch.Table + "_" + field.DBName + "_key", Columns: []string{field.DBName}, Unique: true})
+		}
+	}
+	for _, index := range sch.ParseIndexes() {
+		columns := make([]string, len(index.Fields))
+		for i, option := range index.Fields {
+			columns[i] = option.Expression
+			if option.Field != nil {
+				columns[i] = option.DBName
+			}
+		}
+		indexes = append(indexes, liveIndex{Name: index.Name, Columns: columns, Unique: index.Class == "UNIQUE"})
+	}
+	return indexes
+}
+
+// hasIndex reports whether an index of live covers the columns of want in the same order,
+// and is unique when want is
+func hasIndex(live []liveIndex, want liveIndex) bool {
+	for _, index := range live {
+		if strings.Join(index.Columns, ",") != strings.Join(want.Columns, ",") {
+			continue
+		}
+		if (!want.Unique || index.Unique) && (!want.Primary || index.Primary) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeIndex(index liveIndex) string {
+	switch {
+	case index.Primary:
+		return "primary key " + index.Name
+	case index.Unique:
+		return "unique index " + index.Name
+	default:
+		return "index " + index.Name
+	}
+}
+
+// sortDifferences orders diffs by the position of their column in the model, then columns
+// unknown to the model by name, then indexes in model order
+func sortDifferences(diffs []SchemaDifference, fields []*schema.Field) {
+	position := map[string]int{}
+	for i, field := range fields {
+		position[field.DBName] = i
+	}
+	rank := func(d SchemaDifference) (int, string) {
+		switch d.Kind {
+		case DiffExtraColumn:
+			return len(fields), d.Column
+		case DiffMissingIndex:
+			return len(fields) + 1, ""
+		default:
+			return position[d.Column], ""
+		}
+	}
+	for i := 1; i < len(diffs); i++ {
+		for j := i; j > 0; j-- {
+			a, aName := rank(diffs[j-1])
+			b, bName := rank(diffs[j])
+			if a < b || a == b && aName <= bName {
+				break
+			}
+			diffs[j-1], diffs[j] = diffs[j], diffs[j-1]
+		}
+	}
+}
+
+var (
+	typeSpaces  = regexp.MustCompile(`\s*([(),])\s*`)
+	typeAliases = map[string]string{
+		"character varying":           "varchar",
+		"character":                   "char",
+		"bpchar":                      "char",
+		"timestamp with time zone":    "timestamptz",
+		"timestamp without time zone": "timestamp",
+		"time with time zone":         "timetz",
+		"time without time zone":      "time",
+		"int":                         "integer",
+		"int4":                        "integer",
+		"int8":                        "bigint",
+		"int2":                        "smallint",
+		"serial":                      "integer",
+		"bigserial":                   "bigint",
+		"smallserial":                 "smallint",
+		"bool":                        "boolean",
+		"decimal":                     "numeric",
+		"float8":                      "double precision",
+		"float4":                      "real",
+	}
+	timestampPrecision = regexp.MustCompile(`^(timestamptz|timestamp|timetz|time)\(\d+\)$`)
+)
+
+// canonicalType normalizes the spellings of a Postgres type so the model and the database
+// sides compare equal, e.g. "character varying(255)" and "VARCHAR(255)" become varchar(255)
+func canonicalType(dataType string) string {
+	dataType = strings.ToLower(strings.TrimSpace(dataType))
+	dataType = typeSpaces.ReplaceAllString(dataType, "$1")
+
+	name, args := dataType, ""
+	if i := strings.IndexByte(dataType, '('); i >= 0 {
+		name, args = dataType[:i], dataType[i:]
+	}
+	if alias, ok := typeAliases[name]; ok {
+		name = alias
+	}
+	dataType = name + args
+
+	// Timestamp precision is not compared, 6 is the default on both sides
+	if match := timestampPrecision.FindStringSubmatch(dataType); match != nil {
+		return match[1]
+	}
+	return dataType
+}
+
+// columnDefinition renders the type, NOT NULL and DEFAULT of a column for draft SQL
+func columnDefinition(dialector gorm.Dialector, field *schema.Field, allowNotNull bool) string {
+	definition := dialector.DataTypeOf(field)
+	if field.PrimaryKey && len(field.Schema.PrimaryFields) == 1 {
+		definition += " PRIMARY KEY"
+	}
+	if field.HasDefaultValue && field.DefaultValue != "" {
+		value := field.DefaultValue
+		if field.DefaultValueInterface != nil {
+			if s, ok := field.DefaultValueInterface.(string); ok {
+				value = "'" + strings.ReplaceAll(s, "'", "''") + "'"
+			}
+		}
+		definition += " DEFAULT " + value
+	}
+	if allowNotNull && field.NotNull && !field.PrimaryKey {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+// createTableSQL drafts the table of sch with its indexes
+func createTableSQL(dialector gorm.Dialector, sch *schema.Schema) string {
+	var lines []string
+	for _, field := range modelFields(sch) {
+		lines = append(lines, fmt.Sprintf("    %s %s", field.DBName, columnDefinition(dialector, field, true)))
+	}
+	if len(sch.PrimaryFields) > 1 {
+		lines = append(lines, fmt.Sprintf("    PRIMARY KEY (%s)", strings.Join(sch.PrimaryFieldDBNames, ", ")))
+	}
+
+	statements := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n);", sch.Table, strings.Join(lines, ",\n"))}
+	for _, index := range modelIndexes(sch) {
+		if index.Primary {
+			continue
+		}
+		// The table is new, so the indexes need not be built concurrently
+		statements = append(statements, strings.Replace(createIndexSQL(sch.Table, index), " CONCURRENTLY", "", 1))
+	}
+	return strings.Join(statements, "\n")
+}
+
+// addColumnSQL drafts adding field to table. A NOT NULL column without default is added as
+// nullable, to be backfilled before setting NOT NULL.
+func addColumnSQL(dialector gorm.Dialector, table string, field *schema.Field) string {
+	allowNotNull := !field.NotNull || field.HasDefaultValue && field.DefaultValue != ""
+	statement := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", table, field.DBName, columnDefinition(dialector, field, allowNotNull))
+	if !allowNotNull {
+		statement += fmt.Sprintf("\n-- TODO backfill %s.%s, then: ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, field.DBName, table, field.DBName)
+	}
+	return statement
+}
+
+// createIndexSQL drafts the index on an existing table
+func createIndexSQL(table string, index liveIndex) string {
+	if index.Primary {
+		return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", table, strings.Join(index.Columns, ", "))
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX CONCURRENTLY IF NOT EXISTS %s ON %s (%s);", unique, index.Name, table, strings.Join(index.Columns, ", "))
+}
+
+// DraftMigration joins the SQL of diffs into the bodies of an up and a down migration. The down
+// statements are in reverse order.
+func DraftMigration(diffs []SchemaDifference) (up, down string) {
+	var ups, downs []string
+	for i := range diffs {
+		if diffs[i].Up != "" {
+			ups = append(ups, diffs[i].Up)
+		}
+		if d := diffs[len(diffs)-1-i]; d.Down != "" {
+			downs = append(downs, d.Down)
+		}
+	}
+	return strings.Join(ups, "\n\n") + "\n", strings.Join(downs, "\n\n") + "\n"
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-boilerplate-api/shared/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	replayCreateTable = regexp.MustCompile(`^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\S+)\s*\((.*)\)$`)
+	replayCreateIndex = regexp.MustCompile(`^CREATE\s+(UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(\S+)\s+ON\s+(\S+?)\s*\((.*)\)$`)
+	replayDropTable   = regexp.MustCompile(`^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(\S+)`)
+	replayAddColumn   = regexp.MustCompile(`^ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(.*)$`)
+	replayDropColumn  = regexp.MustCompile(`^DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?(\S+)`)
+	replayColumnType  = regexp.MustCompile(`^ALTER\s+(?:COLUMN\s+)?(\S+)\s+(?:SET\s+DATA\s+)?TYPE\s+(.*)$`)
+	replayNotNull     = regexp.MustCompile(`^ALTER\s+(?:COLUMN\s+)?(\S+)\s+(SET|DROP)\s+NOT\s+NULL$`)
+	replayKeyColumns  = regexp.MustCompile(`^(?:CONSTRAINT\s+\S+\s+)?(PRIMARY\s+KEY|UNIQUE)\s*\((.*)\)$`)
+	replayUnique      = regexp.MustCompile(`\bUNIQUE\b`)
+	// replayTypeEnd ends the type of a column definition
+	replayTypeEnd = regexp.MustCompile(`\s+(?:NOT|NULL|DEFAULT|PRIMARY|UNIQUE|REFERENCES|CHECK|CONSTRAINT|GENERATED|COLLATE)\b`)
+)
+
+// replayMigrations builds the tables the up migrations in dir of fsys leave behind, without a
+// database. It understands the CREATE TABLE, CREATE INDEX, ALTER TABLE and DROP statements the
+// migrations use and ignores the others.
+func replayMigrations(t *testing.T, fsys fs.FS, dir string) map[string]*liveTable {
+	t.Helper()
+	migrations, err := ListMigrations(fsys, dir)
+	if err != nil {
+		t.Fatalf("ListMigrations failed: %v", err)
+	}
+	upFiles, _, err := migrationFileNames(fsys, dir)
+	if err != nil {
+		t.Fatalf("migrationFileNames failed: %v", err)
+	}
+
+	tables := map[string]*liveTable{}
+	for _, migration := range migrations {
+		content, err := fs.ReadFile(fsys, path.Join(dir, upFiles[migration.Version]))
+		if err != nil {
+			t.Fatalf("failed to read migration %d: %v", migration.Version, err)
+		}
+		for _, stmt := range parseSQL(string(content)).statements {
+			replayStatement(t, tables, stmt.text)
+		}
+	}
+	return tables
+}
+
+// replayStatement applies a statement of parseSQL, which is upper cased, to tables
+func replayStatement(t *testing.T, tables map[string]*liveTable, stmt string) {
+	lower := func(s string) string { return normalizeTableName(strings.TrimSpace(s)) }
+
+	if match := replayCreateTable.FindStringSubmatch(stmt); match != nil {
+		name := lower(match[1])
+		if tables[name] != nil {
+			return
+		}
+		table := &liveTable{Columns: map[string]liveColumn{}}
+		tables[name] = table
+		for _, element := range splitTopLevel(match[2]) {
+			if keys := replayKeyColumns.FindStringSubmatch(element); keys != nil {
+				replayKey(table, name, strings.HasPrefix(keys[1], "PRIMARY"), splitColumns(keys[2]))
+				continue
+			}
+			if strings.HasPrefix(element, "CONSTRAINT ") || strings.HasPrefix(element, "FOREIGN ") || strings.HasPrefix(element, "CHECK ") {
+				continue
+			}
+			replayColumn(table, name, element)
+		}
+		return
+	}
+
+	if match := replayCreateIndex.FindStringSubmatch(stmt); match != nil {
+		table := tables[lower(match[3])]
+		if table == nil {
+			t.Fatalf("index %s on unknown table %s", lower(match[2]), lower(match[3]))
+		}
+		table.Indexes = append(table.Indexes, liveIndex{Name: lower(match[2]), Columns: splitColumns(match[4]), Unique: match[1] != ""})
+		return
+	}
+
+	if match := replayDropTable.FindStringSubmatch(stmt); match != nil {
+		delete(tables, lower(match[1]))
+		return
+	}
+
+	match := alterTablePattern.FindStringSubmatch(stmt)
+	if match == nil {
+		return
+	}
+	name := lower(match[1])
+	table := tables[name]
+	if table == nil {
+		t.Fatalf("ALTER TABLE of unknown table %s", name)
+	}
+	for _, action := range splitTopLevel(match[2]) {
+		switch {
+		case addConstraintPattern.MatchString(action):
+			if keys := replayKeyColumns.FindStringSubmatch(strings.TrimPrefix(action, "ADD ")); keys != nil {
+				replayKey(table, name, strings.HasPrefix(keys[1], "PRIMARY"), splitColumns(keys[2]))
+			}
+		case replayAddColumn.MatchString(action):
+			replayColumn(table, name, replayAddColumn.FindStringSubmatch(action)[1])
+		case replayColumnType.MatchString(action):
+			m := replayColumnType.FindStringSubmatch(action)
+			column := table.Columns[lower(m[1])]
+			column.Type = canonicalType(replayTypeEnd.Split(m[2]+" ", 2)[0])
+			table.Columns[lower(m[1])] = column
+		case replayNotNull.MatchString(action):
+			m := replayNotNull.FindStringSubmatch(action)
+			column := table.Columns[lower(m[1])]
+			column.Nullable = m[2] == "DROP"
+			table.Columns[lower(m[1])] = column
+		case replayDropColumn.MatchString(action):
+			column := lower(replayDropColumn.FindStringSubmatch(action)[1])
+			if column != "constraint" {
+				delete(table.Columns, column)
+			}
+		}
+	}
+}
+
+// replayColumn adds the column defined by definition, with its inline keys
+func replayColumn(table *liveTable, tableName, definition string) {
+	fields := strings.SplitN(definition, " ", 2)
+	column := normalizeTableName(fields[0])
+	rest := ""
+	if len(fields) > 1 {
+		rest = fields[1] + " "
+	}
+	typeEnd := len(rest)
+	if loc := replayTypeEnd.FindStringIndex(" " + rest); loc != nil {
+		typeEnd = max(loc[0]-1, 0)
+	}
+	primary := strings.Contains(rest, "PRIMARY KEY")
+	table.Columns[column] = liveColumn{
+		Type:     canonicalType(rest[:typeEnd]),
+		Nullable: !primary && !notNullPattern.MatchString(rest),
+	}
+	if primary || replayUnique.MatchString(rest) {
+		replayKey(table, tableName, primary, []string{column})
+	}
+}
+
+// replayKey adds the index backing a primary key or unique constraint
+func replayKey(table *liveTable, tableName string, primary bool, columns []string) {
+	name := tableName + "_pkey"
+	if !primary {
+		name = tableName + "_" + strings.Join(columns, "_") + "_key"
+	}
+	table.Indexes = append(table.Indexes, liveIndex{Name: name, Columns: columns, Unique: true, Primary: primary})
+}
+
+func splitColumns(list string) []string {
+	var columns []string
+	for _, column := range strings.Split(list, ",") {
+		columns = append(columns, normalizeTableName(strings.Fields(column)[0]))
+	}
+	return columns
+}
+
+// TestModelsMatchMigrations fails when a model in models.All disagrees with the schema the
+// embedded migrations create, the same check as cmd/migrate diff without a database
+func TestModelsMatchMigrations(t *testing.T) {
+	tables := replayMigrations(t, migrationsFS, "migrations")
+	dialector := postgres.New(postgres.Config{})
+	cache := &sync.Map{}
+
+	for _, model := range models.All() {
+		sch, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatalf("failed to parse model %T: %v", model, err)
+		}
+		for _, diff := range compareModel(dialector, sch, tables[sch.Table]) {
+			t.Errorf("%T: %s", model, diff)
+		}
+	}
+}
+
+func TestReplayMigrations(t *testing.T) {
+	tables := replayMigrations(t, migrationsFS, "migrations")
+
+	users := tables["users"]
+	if users == nil {
+		t.Fatal("users table missing")
+	}
+	for column, want := range map[string]liveColumn{
+		"id":         {Type: "uuid"},
+		"email":      {Type: "varchar(255)"},
+		"first_name": {Type: "varchar(100)", Nullable: true},
+		"role":       {Type: "varchar(50)"},
+		"deleted_at": {Type: "timestamptz", Nullable: true},
+	} {
+		if got := users.Columns[column]; got != want {
+			t.Errorf("users.%s = %+v, want %+v", column, got, want)
+		}
+	}
+	for _, want := range []liveIndex{
+		{Columns: []string{"id"}, Unique: true, Primary: true},
+		{Columns: []string{"email"}, Unique: true},
+		{Columns: []string{"status"}},
+	} {
+		if !hasIndex(users.Indexes, want) {
+			t.Errorf("users has no index on %v (unique %v, primary %v)", want.Columns, want.Unique, want.Primary)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ConfirmPasswordParams struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// UserExport is the archive of everything stored about a user
+type UserExport struct {
+	ExportedAt          time.Time                   `json:"exported_at"`
+	User                models.User                 `json:"user"`
+	Sessions            []models.Session            `json:"sessions"`
+	EmailChangeRequests []models.EmailChangeRequest `json:"email_change_requests"`
+	// ImpersonationAuditLogs are the entries where the user is the subject or the actor
+	ImpersonationAuditLogs []models.ImpersonationAuditLog `json:"impersonation_audit_logs"`
+}
+
+// DeactivateMe deactivates the authenticated user's account.
+// Deactivated users cannot log in until an admin re-enables them.
+func DeactivateMe(c *fiber.Ctx) error {
+	user, err := confirmCurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	err = gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("status", models.UserStatusDeactivated).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, nil, "Account deactivated")
+}
+
+// DeleteMe soft deletes the authenticated user's account.
+// Personal data is anonymized by the erasure job once the grace period has passed.
+func DeleteMe(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := confirmCurrentUser(c)
+		if err != nil {
+			return err
+		}
+
+		gormDB, err := requestDB(c)
+		if err != nil {
+			return err
+		}
+		if err := deleteUser(gormDB, user); err != nil {
+			return err
+		}
+
+		return helpers.SendOK(c, fiber.Map{
+			"erasure_after": time.Now().UTC().Add(cfg.ErasureGracePeriod),
+		}, "Account deleted")
+	}
+}
+
+// ExportMe returns a JSON archive of everything stored about the authenticated user
+func ExportMe(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+
+	export := UserExport{
+		ExportedAt:             time.Now().UTC(),
+		User:                   *user,
+		Sessions:               []models.Session{},
+		EmailChangeRequests:    []models.EmailChangeRequest{},
+		ImpersonationAuditLogs: []models.ImpersonationAuditLog{},
+	}
+
+	if err := gormDB.Where("user_id = ?", user.ID).Order("created_at").Find(&export.Sessions).Error; err != nil {
+		return err
+	}
+	if err := gormDB.Where("user_id = ?", user.ID).Order("created_at").Find(&export.EmailChangeRequests).Error; err != nil {
+		return err
+	}
+	err = gormDB.Where("subject_id = ? OR actor_id = ?", user.ID, user.ID).
+		Order("created_at").
+		Find(&export.ImpersonationAuditLogs).Error
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(fmt.Sprintf("user-export-%s.json", user.ID))
+	return c.JSON(export)
+}
+
+// confirmCurrentUser loads the authenticated user and checks the password in the request body
+func confirmCurrentUser(c *fiber.Ctx) (*models.User, error) {
+	var params ConfirmPasswordParams
+
+	if err := c.BodyParser(&params); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	user, err := currentUserFromPrimary(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CheckPassword(user.PasswordHash, params.Password) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid password")
+	}
+
+	return user, nil
+}
+
+// deleteUser soft deletes a user and revokes all of their sessions
+func deleteUser(gormDB *gorm.DB, user *models.User) error {
+	return gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+}
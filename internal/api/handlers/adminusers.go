@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultPerPage is the page size used when per_page is not given
+const defaultPerPage = 20
+
+// adminUserSorts maps the accepted sort values to ORDER BY clauses.
+// created_at sorts and created_at range filters are served by idx_users_created_at.
+var adminUserSorts = map[string]string{
+	"created_at":  "created_at ASC, id ASC",
+	"-created_at": "created_at DESC, id DESC",
+	"email":       "email ASC",
+	"-email":      "email DESC",
+}
+
+type ListUsersParams struct {
+	Email         string `query:"email" validate:"omitempty,email"`
+	EmailContains string `query:"email_contains" validate:"omitempty,max=255"`
+	Status        string `query:"status" validate:"omitempty,oneof=active disabled deactivated"`
+	CreatedFrom   string `query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo     string `query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Sort          string `query:"sort" validate:"omitempty,oneof=created_at -created_at email -email"`
+	Page          int    `query:"page" validate:"omitempty,min=1"`
+	PerPage       int    `query:"per_page" validate:"omitempty,min=1,max=100"`
+}
+
+type AdminUpdateUserParams struct {
+	Email     *string `json:"email" validate:"omitempty,email,max=255"`
+	FirstName *string `json:"first_name" validate:"omitempty,max=100"`
+	LastName  *string `json:"last_name" validate:"omitempty,max=100"`
+	Role      *string `json:"role" validate:"omitempty,oneof=user admin"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"total_pages"`
+}
+
+type UserListResponse struct {
+	Items      []models.User `json:"items"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+// AdminListUsers lists users with filtering, sorting and pagination.
+// email_contains is a case-insensitive substring match served by the pg_trgm GIN index
+// idx_users_email_trgm (migration 000009); searches shorter than 3 characters scan users.
+func AdminListUsers(c *fiber.Ctx) error {
+	var params ListUsersParams
+
+	if err := c.QueryParser(&params); err != nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid query parameters")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return helpers.SendBadRequest(c, "validation_error", err.Error())
+	}
+
+	if params.Page == 0 {
+		params.Page = 1
+	}
+	if params.PerPage == 0 {
+		params.PerPage = defaultPerPage
+	}
+	if params.Sort == "" {
+		params.Sort = "-created_at"
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	query := gormDB.Model(&models.User{})
+
+	if params.Email != "" {
+		// Exact match uses idx_users_email
+		query = query.Where("email = ?", strings.ToLower(params.Email))
+	}
+	if params.EmailContains != "" {
+		// Substring match uses idx_users_email_trgm
+		query = query.Where("email ILIKE ?", "%"+escapeLike(params.EmailContains)+"%")
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	if params.CreatedFrom != "" {
+		from, _ := time.Parse(time.RFC3339, params.CreatedFrom)
+		query = query.Where("created_at >= ?", from)
+	}
+	if params.CreatedTo != "" {
+		to, _ := time.Parse(time.RFC3339, params.CreatedTo)
+		query = query.Where("created_at < ?", to)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return err
+	}
+
+	users := []models.User{}
+	err = query.Order(adminUserSorts[params.Sort]).
+		Limit(params.PerPage).
+		Offset((params.Page - 1) * params.PerPage).
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, UserListResponse{
+		Items: users,
+		Pagination: Pagination{
+			Page:       params.Page,
+			PerPage:    params.PerPage,
+			Total:      total,
+			TotalPages: (total + int64(params.PerPage) - 1) / int64(params.PerPage),
+		},
+	}, "Users retrieved")
+}
+
+// AdminGetUser returns a single user
+func AdminGetUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, user, "User retrieved")
+}
+
+// AdminUpdateUser updates profile fields and the role of a user
+func AdminUpdateUser(c *fiber.Ctx) error {
+	var params AdminUpdateUserParams
+
+	if err := c.BodyParser(&params); err != nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid request body")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return helpers.SendBadRequest(c, "validation_error", err.Error())
+	}
+
+	user, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+
+	if params.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*params.Email))
+		taken, err := emailTaken(gormDB, email, user.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return helpers.SendError(c, fiber.StatusConflict, "conflict", "Email is already in use")
+		}
+		updates["email"] = email
+	}
+	if params.FirstName != nil {
+		updates["first_name"] = strings.TrimSpace(*params.FirstName)
+	}
+	if params.LastName != nil {
+		updates["last_name"] = strings.TrimSpace(*params.LastName)
+	}
+	if params.Role != nil {
+		if isSelf(c, user.ID) && *params.Role != models.UserRoleAdmin {
+			return helpers.SendBadRequest(c, "invalid_request", "You cannot remove your own admin role")
+		}
+		updates["role"] = *params.Role
+	}
+
+	if len(updates) > 0 {
+		if err := gormDB.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := gormDB.First(user, "id = ?", user.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return helpers.SendOK(c, user, "User updated")
+}
+
+// AdminDisableUser disables a user and revokes all of their sessions
+func AdminDisableUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	if isSelf(c, user.ID) {
+		return helpers.SendBadRequest(c, "invalid_request", "You cannot disable your own account")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	err = gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("status", models.UserStatusDisabled).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, user, "User disabled")
+}
+
+// AdminEnableUser re-enables a disabled or deactivated user
+func AdminEnableUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	err = gormDB.Model(user).Update("status", models.UserStatusActive).Error
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, user, "User enabled")
+}
+
+// AdminDeleteUser soft deletes a user and revokes all of their sessions
+func AdminDeleteUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	if isSelf(c, user.ID) {
+		return helpers.SendBadRequest(c, "invalid_request", "You cannot delete your own account")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	if err := deleteUser(gormDB, user); err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, nil, "User deleted")
+}
+
+// findUserParam loads the user referenced by the :id route parameter
+func findUserParam(c *fiber.Ctx) (*models.User, error) {
+	userID := c.Params("id")
+	if !helpers.IsValidUUID(userID) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid user id")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	err = gormDB.First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// isSelf reports whether userID is the authenticated user
+func isSelf(c *fiber.Ctx, userID string) bool {
+	sub, _ := helpers.GetClaimStr(c, "sub")
+	return sub == userID
+}
+
+// revokeUserSessions revokes every active session of a user
+func revokeUserSessions(tx *gorm.DB, userID string) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
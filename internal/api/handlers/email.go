@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EmailSender delivers an email to a single recipient
+type EmailSender func(to, subject, body string) error
+
+// SendEmail is used by handlers to deliver verification emails.
+// Set it at startup to a real provider; when nil, emails are only logged if LOG_EMAILS is enabled.
+var SendEmail EmailSender
+
+// deliverEmail sends an email through SendEmail or falls back to logging it
+func deliverEmail(c *fiber.Ctx, cfg *config.Config, to, subject, body string) error {
+	if SendEmail != nil {
+		return SendEmail(to, subject, body)
+	}
+
+	if !cfg.LogEmails {
+		logger.FromCtx(c).Warn().Str("subject", subject).Str("to", to).Msg("No email sender configured, dropping email")
+		return nil
+	}
+
+	logger.FromCtx(c).Info().Str("to", to).Str("subject", subject).Str("body", body).Msg("Email")
+	return nil
+}
@@ -1,64 +1,51 @@
 package handlers
 
 import (
-	"context"
-	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/internal/api/health"
 	"go-boilerplate-api/shared/helpers"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func Health(ctx *fiber.Ctx) error {
-	healthCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// Livez answers the liveness probe. It never checks dependencies, so an outage of
+// Postgres or Redis does not get every instance restarted.
+func Livez(registry *health.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return sendReport(c, registry.Live(), "Alive", "Not alive")
+	}
+}
+
+// Readyz answers the readiness probe. It fails when a critical check fails or shutdown began.
+func Readyz(registry *health.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return sendReport(c, registry.Ready(c.UserContext()), "Ready", "Not ready")
+	}
+}
 
-	checks := fiber.Map{}
-	httpStatus := fiber.StatusOK
+// Startupz answers the startup probe. It fails until initialization finished.
+func Startupz(registry *health.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return sendReport(c, registry.Startup(c.UserContext()), "Started", "Not started")
+	}
+}
 
-	if db.DB != nil {
-		err := db.HealthCheckGORM(healthCtx)
-		poolStats, statsErr := db.GetPoolStats()
-		
-		if err != nil {
-			checks["postgres"] = fiber.Map{
-				"status": "error",
-				"message": err.Error(),
-			}
-			httpStatus = fiber.StatusServiceUnavailable
-		} else {
-			postgresCheck := fiber.Map{"status": "ok"}
-			if statsErr == nil && poolStats != nil {
-				postgresCheck["stats"] = fiber.Map{
-					"max_open_connections": poolStats.MaxOpenConnections,
-					"open_connections":     poolStats.OpenConnections,
-					"in_use":               poolStats.InUse,
-					"idle":                 poolStats.Idle,
-					"wait_count":           poolStats.WaitCount,
-					"wait_duration":        poolStats.WaitDuration,
-					"max_idle_closed":      poolStats.MaxIdleClosed,
-					"max_idle_time_closed": poolStats.MaxIdleTimeClosed,
-					"max_lifetime_closed":  poolStats.MaxLifetimeClosed,
-				}
-			}
-			checks["postgres"] = postgresCheck
-		}
+// sendReport answers with the overall status, adding per-check results when ?verbose is set.
+// Check errors and details, such as pool statistics, are only shown to authenticated callers.
+func sendReport(c *fiber.Ctx, report health.Report, okMessage, failMessage string) error {
+	status, message := fiber.StatusOK, okMessage
+	if !report.Healthy() {
+		status, message = fiber.StatusServiceUnavailable, failMessage
 	}
 
-	if db.RedisClient != nil {
-		err := db.HealthCheckRedis(healthCtx)
-		if err != nil {
-			checks["redis"] = fiber.Map{
-				"status": "error",
-				"message": err.Error(),
-			}
-			if httpStatus == fiber.StatusOK {
-				httpStatus = fiber.StatusServiceUnavailable
-			}
-		} else {
-			checks["redis"] = fiber.Map{"status": "ok"}
+	if !c.Request().URI().QueryArgs().Has("verbose") {
+		report.Checks = nil
+	} else if c.Locals("user") == nil {
+		for name, result := range report.Checks {
+			result.Error = ""
+			result.Details = nil
+			report.Checks[name] = result
 		}
 	}
 
-	return helpers.SendSuccess(ctx, httpStatus, checks, "Health check completed")
+	return helpers.SendSuccess(c, status, report, message)
 }
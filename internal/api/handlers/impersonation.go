@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"time"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	SubjectID string    `json:"subject_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AdminImpersonateUser issues a short-lived token acting as another user.
+// The token carries the admin in the act claim and never outlives the admin's own token.
+func AdminImpersonateUser(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return impersonateUser(c, cfg)
+	}
+}
+
+func impersonateUser(c *fiber.Ctx, cfg *config.Config) error {
+	target, err := findUserParam(c)
+	if err != nil {
+		return err
+	}
+
+	actorID := helpers.GetActorID(c)
+	if target.ID == actorID {
+		return helpers.SendBadRequest(c, "invalid_request", "You cannot impersonate yourself")
+	}
+	if target.Role == models.UserRoleAdmin {
+		return helpers.SendForbidden(c, "Admins cannot be impersonated")
+	}
+	if target.Status != models.UserStatusActive {
+		return helpers.SendError(c, fiber.StatusConflict, "conflict", "Only active users can be impersonated")
+	}
+
+	sessionID, err := helpers.GetClaimStr(c, "sid")
+	if err != nil {
+		return helpers.SendUnauthorized(c, "Invalid token claims")
+	}
+
+	expiresAt := time.Now().UTC().Add(cfg.ImpersonationTTL)
+	if claims, ok := c.Locals("user").(jwt.MapClaims); ok {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expiresAt) {
+			expiresAt = exp.UTC()
+		}
+	}
+
+	token, err := helpers.GenerateImpersonationToken(cfg.SecretKey, target.ID, actorID, sessionID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	entry := models.ImpersonationAuditLog{
+		ActorID:    actorID,
+		SubjectID:  target.ID,
+		SessionID:  &sessionID,
+		Action:     models.ImpersonationActionStart,
+		Method:     c.Method(),
+		Path:       c.Path(),
+		StatusCode: fiber.StatusOK,
+		IPAddress:  c.IP(),
+		RequestID:  c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	if err := gormDB.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, ImpersonationResponse{
+		Token:     token,
+		SubjectID: target.ID,
+		ExpiresAt: expiresAt,
+	}, "Impersonation token issued")
+}
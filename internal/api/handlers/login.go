@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"strings"
+	"time"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/db"
 	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 type LoginParams struct {
@@ -11,7 +20,24 @@ type LoginParams struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
-func LoginHandler(c *fiber.Ctx) error {
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// dummyPasswordHash is compared against when the user does not exist so that
+// unknown and known usernames take the same time to reject
+const dummyPasswordHash = "$2a$10$7rHExN6EV5xBpFsWwtG6tesFOuS8/9cT7C0xrJrkOlnpHzD5p6wnq"
+
+// LoginHandler authenticates a user and issues a token bound to a new session
+func LoginHandler(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return login(c, cfg)
+	}
+}
+
+func login(c *fiber.Ctx, cfg *config.Config) error {
 	var params LoginParams
 
 	if err := c.BodyParser(&params); err != nil {
@@ -22,6 +48,58 @@ func LoginHandler(c *fiber.Ctx) error {
 		return helpers.SendBadRequest(c, "validation_error", err.Error())
 	}
 
-	// TODO: Implement login logic
-	return helpers.SendError(c, fiber.StatusNotImplemented, "not_implemented", "Login functionality not yet implemented")
+	gormDB := db.GetDB()
+	if gormDB == nil {
+		return helpers.SendError(c, fiber.StatusServiceUnavailable, "service_unavailable", "Database is not configured")
+	}
+	gormDB = gormDB.WithContext(c.UserContext())
+
+	// The password and status must be current, so the user is never read from a lagging replica
+	var user models.User
+	err := gormDB.Clauses(dbresolver.Write).Where("email = ?", strings.ToLower(strings.TrimSpace(params.Username))).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err != nil {
+		helpers.CheckPassword(dummyPasswordHash, params.Password)
+		return helpers.SendUnauthorized(c, "Invalid username or password")
+	}
+	if !helpers.CheckPassword(user.PasswordHash, params.Password) {
+		return helpers.SendUnauthorized(c, "Invalid username or password")
+	}
+	if user.Status != models.UserStatusActive {
+		return helpers.SendForbidden(c, "Account is disabled")
+	}
+
+	now := time.Now().UTC()
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  truncate(c.Get(fiber.HeaderUserAgent), 512),
+		IPAddress:  c.IP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(cfg.TokenTTL),
+	}
+	if err := gormDB.Create(&session).Error; err != nil {
+		return err
+	}
+
+	token, err := helpers.GenerateToken(cfg.SecretKey, user.ID, session.ID, session.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, LoginResponse{
+		Token:     token,
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+	}, "Login successful")
+}
+
+// truncate cuts s to at most max bytes so it fits the column size
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
 }
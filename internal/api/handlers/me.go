@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// emailChangeTTL is how long an email change verification token stays valid
+const emailChangeTTL = 24 * time.Hour
+
+// patchableUserFields lists the fields PATCH /me accepts with their maximum length in characters
+var patchableUserFields = map[string]int{
+	"first_name": 100,
+	"last_name":  100,
+}
+
+type ChangeEmailParams struct {
+	NewEmail string `json:"new_email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required"`
+}
+
+type VerifyEmailParams struct {
+	Token string `json:"token" validate:"required,len=64,hexadecimal"`
+}
+
+type ChangePasswordParams struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// GetMe returns the profile of the authenticated user
+func GetMe(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, user, "Profile retrieved")
+}
+
+// UpdateMe applies a JSON Merge Patch (RFC 7396) to the authenticated user's profile.
+// Only first_name and last_name can be changed; null clears the field.
+func UpdateMe(c *fiber.Ctx) error {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+	if contentType != "application/merge-patch+json" && contentType != fiber.MIMEApplicationJSON {
+		return helpers.SendError(c, fiber.StatusUnsupportedMediaType, "unsupported_media_type",
+			"Content-Type must be application/merge-patch+json or application/json")
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || patch == nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Request body must be a JSON object")
+	}
+
+	updates := map[string]interface{}{}
+	for key, raw := range patch {
+		maxLen, ok := patchableUserFields[key]
+		if !ok {
+			return helpers.SendError(c, fiber.StatusUnprocessableEntity, "validation_error", fmt.Sprintf("%s cannot be updated", key))
+		}
+
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			updates[key] = nil
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return helpers.SendError(c, fiber.StatusUnprocessableEntity, "validation_error", fmt.Sprintf("%s must be a string or null", key))
+		}
+		value = strings.TrimSpace(value)
+		if utf8.RuneCountInString(value) > maxLen {
+			return helpers.SendError(c, fiber.StatusUnprocessableEntity, "validation_error", fmt.Sprintf("%s must be at most %d characters", key, maxLen))
+		}
+		updates[key] = value
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if len(updates) > 0 {
+		gormDB, err := requestDB(c)
+		if err != nil {
+			return err
+		}
+		if err := gormDB.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := gormDB.First(user, "id = ?", user.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return helpers.SendOK(c, user, "Profile updated")
+}
+
+// RequestEmailChange starts an email change. The address is only switched once the
+// verification token sent to the new address is confirmed through VerifyEmailChange.
+func RequestEmailChange(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return requestEmailChange(c, cfg)
+	}
+}
+
+func requestEmailChange(c *fiber.Ctx, cfg *config.Config) error {
+	var params ChangeEmailParams
+
+	if err := c.BodyParser(&params); err != nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid request body")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return helpers.SendBadRequest(c, "validation_error", err.Error())
+	}
+
+	user, err := currentUserFromPrimary(c)
+	if err != nil {
+		return err
+	}
+
+	if !helpers.CheckPassword(user.PasswordHash, params.Password) {
+		return helpers.SendUnauthorized(c, "Invalid password")
+	}
+
+	newEmail := strings.ToLower(strings.TrimSpace(params.NewEmail))
+	if newEmail == user.Email {
+		return helpers.SendBadRequest(c, "invalid_request", "New email must differ from the current email")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+
+	taken, err := emailTaken(gormDB, newEmail, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return helpers.SendError(c, fiber.StatusConflict, "conflict", "Email is already in use")
+	}
+
+	token, err := helpers.GenerateSecureToken()
+	if err != nil {
+		return err
+	}
+
+	request := models.EmailChangeRequest{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: helpers.HashToken(token),
+		ExpiresAt: time.Now().UTC().Add(emailChangeTTL),
+	}
+	if err := gormDB.Create(&request).Error; err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Confirm your new email address with this token: %s\nIt expires at %s.",
+		token, request.ExpiresAt.Format(time.RFC3339))
+	if err := deliverEmail(c, cfg, newEmail, "Confirm your new email address", body); err != nil {
+		return err
+	}
+
+	return helpers.SendSuccess(c, fiber.StatusAccepted, nil, "Verification email sent to the new address")
+}
+
+// VerifyEmailChange confirms a pending email change using the token sent to the new address.
+// The user row is locked and must belong to an active, not deleted account.
+func VerifyEmailChange(c *fiber.Ctx) error {
+	var params VerifyEmailParams
+
+	if err := c.BodyParser(&params); err != nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid request body")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return helpers.SendBadRequest(c, "validation_error", err.Error())
+	}
+
+	errInvalidToken := errors.New("invalid token")
+	errEmailTaken := errors.New("email taken")
+	errAccountInactive := errors.New("account inactive")
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	err = gormDB.Transaction(func(tx *gorm.DB) error {
+		var request models.EmailChangeRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND confirmed_at IS NULL AND expires_at > ?", helpers.HashToken(params.Token), time.Now().UTC()).
+			First(&request).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+
+		// Soft deleted users are excluded by the default scope
+		var user models.User
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&user, "id = ?", request.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errAccountInactive
+		}
+		if err != nil {
+			return err
+		}
+		if user.Status != models.UserStatusActive {
+			return errAccountInactive
+		}
+
+		taken, err := emailTaken(tx, request.NewEmail, request.UserID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errEmailTaken
+		}
+
+		now := time.Now().UTC()
+		result := tx.Model(&models.User{}).Where("id = ?", request.UserID).Updates(map[string]interface{}{
+			"email":             request.NewEmail,
+			"email_verified_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAccountInactive
+		}
+
+		if err := tx.Model(&request).Update("confirmed_at", now).Error; err != nil {
+			return err
+		}
+
+		// Invalidate any other pending change for this user
+		return tx.Where("user_id = ? AND confirmed_at IS NULL", request.UserID).
+			Delete(&models.EmailChangeRequest{}).Error
+	})
+
+	switch {
+	case errors.Is(err, errInvalidToken):
+		return helpers.SendBadRequest(c, "invalid_token", "Verification token is invalid or has expired")
+	case errors.Is(err, errEmailTaken):
+		return helpers.SendError(c, fiber.StatusConflict, "conflict", "Email is already in use")
+	case errors.Is(err, errAccountInactive):
+		return helpers.SendForbidden(c, "Account is disabled")
+	case err != nil:
+		return err
+	}
+
+	return helpers.SendOK(c, nil, "Email address updated")
+}
+
+// ChangePassword updates the authenticated user's password after checking the current one.
+// All other sessions of the user are revoked and pending email changes are cancelled.
+func ChangePassword(c *fiber.Ctx) error {
+	var params ChangePasswordParams
+
+	if err := c.BodyParser(&params); err != nil {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid request body")
+	}
+
+	if err := helpers.ValidateStruct(&params); err != nil {
+		return helpers.SendBadRequest(c, "validation_error", err.Error())
+	}
+
+	user, err := currentUserFromPrimary(c)
+	if err != nil {
+		return err
+	}
+
+	if !helpers.CheckPassword(user.PasswordHash, params.CurrentPassword) {
+		return helpers.SendUnauthorized(c, "Invalid current password")
+	}
+	if params.NewPassword == params.CurrentPassword {
+		return helpers.SendBadRequest(c, "invalid_request", "New password must differ from the current password")
+	}
+
+	hash, err := helpers.HashPassword(params.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	sessionID, _ := helpers.GetClaimStr(c, "sid")
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	err = gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, sessionID).
+			Update("revoked_at", time.Now().UTC()).Error
+		if err != nil {
+			return err
+		}
+
+		// A change requested with the old password must not outlive it
+		return tx.Where("user_id = ? AND confirmed_at IS NULL", user.ID).
+			Delete(&models.EmailChangeRequest{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return helpers.SendOK(c, nil, "Password updated")
+}
+
+// requestDB returns the database bound to the request context, or a 503 error when no
+// database is configured
+func requestDB(c *fiber.Ctx) (*gorm.DB, error) {
+	gormDB := db.GetDB()
+	if gormDB == nil {
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "Database is not configured")
+	}
+	return gormDB.WithContext(c.UserContext()), nil
+}
+
+// currentUser loads the user referenced by the sub claim of the request token
+func currentUser(c *fiber.Ctx) (*models.User, error) {
+	return loadCurrentUser(c, false)
+}
+
+// currentUserFromPrimary is currentUser reading from the primary, for password checks that
+// gate a write: a lagging replica may still hold the previous password hash
+func currentUserFromPrimary(c *fiber.Ctx) (*models.User, error) {
+	return loadCurrentUser(c, true)
+}
+
+func loadCurrentUser(c *fiber.Ctx, primary bool) (*models.User, error) {
+	userID, err := helpers.GetClaimStr(c, "sub")
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token claims")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return nil, err
+	}
+	if primary {
+		gormDB = gormDB.Clauses(dbresolver.Write)
+	}
+	var user models.User
+	err = gormDB.First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// emailTaken reports whether email belongs to a user other than userID.
+// Soft deleted users are included since their email is still held by the unique index.
+func emailTaken(tx *gorm.DB, email, userID string) (bool, error) {
+	var count int64
+	err := tx.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	return count > 0, err
+}
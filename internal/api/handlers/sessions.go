@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"time"
+
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions returns the active sessions of the authenticated user
+func ListSessions(c *fiber.Ctx) error {
+	userID, err := helpers.GetClaimStr(c, "sub")
+	if err != nil {
+		return helpers.SendUnauthorized(c, "Invalid token claims")
+	}
+	currentID, _ := helpers.GetClaimStr(c, "sid")
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	var sessions []models.Session
+	err = gormDB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now().UTC()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	return helpers.SendOK(c, response, "Sessions retrieved")
+}
+
+// RevokeSession revokes one of the authenticated user's sessions.
+// Tokens bound to the session are rejected by middlewares.Protected from then on.
+func RevokeSession(c *fiber.Ctx) error {
+	userID, err := helpers.GetClaimStr(c, "sub")
+	if err != nil {
+		return helpers.SendUnauthorized(c, "Invalid token claims")
+	}
+
+	sessionID := c.Params("id")
+	if !helpers.IsValidUUID(sessionID) {
+		return helpers.SendBadRequest(c, "invalid_request", "Invalid session id")
+	}
+
+	gormDB, err := requestDB(c)
+	if err != nil {
+		return err
+	}
+	result := gormDB.
+		Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return helpers.SendNotFound(c, "Session not found")
+	}
+
+	return helpers.SendOK(c, nil, "Session revoked")
+}
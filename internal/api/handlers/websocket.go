@@ -1,9 +1,10 @@
 package handlers
 
 import (
-	"log"
 	"sync"
 
+	"go-boilerplate-api/internal/api/logger"
+
 	"github.com/gofiber/websocket/v2"
 )
 
@@ -28,18 +29,19 @@ func HandleWebSocket(c *websocket.Conn) {
 		mt  int
 		msg []byte
 		err error
+		log = logger.FromLocals(c.Locals)
 	)
 
 	for {
 		if mt, msg, err = c.ReadMessage(); err != nil {
-			log.Println("websocket read error:", err)
+			log.Debug().Err(err).Msg("websocket read error")
 			break
 		}
 
 		clientsMu.RLock()
 		for client := range clients {
 			if err = client.WriteMessage(mt, msg); err != nil {
-				log.Println("websocket write error:", err)
+				log.Warn().Err(err).Msg("websocket write error")
 				client.Close()
 				delete(clients, client)
 			}
@@ -54,7 +56,7 @@ func BroadcastMessage(message []byte) {
 	
 	for client := range clients {
 		if err := client.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Println("broadcast error:", err)
+			logger.FromLocals(client.Locals).Warn().Err(err).Msg("broadcast error")
 			client.Close()
 			delete(clients, client)
 		}
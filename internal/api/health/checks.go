@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"go-boilerplate-api/internal/api/db"
+)
+
+// PostgresChecker pings the GORM connection and reports the statistics of the shared pool
+func PostgresChecker() HealthChecker {
+	return CheckerFunc(func(ctx context.Context) (map[string]any, error) {
+		if err := db.HealthCheckGORM(ctx); err != nil {
+			return nil, err
+		}
+
+		stats, err := db.GetPoolStats()
+		if err != nil {
+			return nil, nil
+		}
+		return map[string]any{
+			"max_conns":                  stats.MaxConns,
+			"total_conns":                stats.TotalConns,
+			"acquired_conns":             stats.AcquiredConns,
+			"idle_conns":                 stats.IdleConns,
+			"constructing_conns":         stats.ConstructingConns,
+			"acquire_count":              stats.AcquireCount,
+			"empty_acquire_count":        stats.EmptyAcquireCount,
+			"empty_acquire_wait_time":    stats.EmptyAcquireWaitTime,
+			"canceled_acquire_count":     stats.CanceledAcquireCount,
+			"max_idle_destroy_count":     stats.MaxIdleDestroyCount,
+			"max_lifetime_destroy_count": stats.MaxLifetimeDestroyCount,
+		}, nil
+	})
+}
+
+// ReplicasChecker reports the health, replication lag and pool statistics of each read
+// replica, as found by their background health checks. It fails when no replica is healthy, reads then go to the
+// primary.
+func ReplicasChecker() HealthChecker {
+	return CheckerFunc(func(ctx context.Context) (map[string]any, error) {
+		details := map[string]any{}
+		healthy := 0
+		for _, state := range db.ReplicaStatus() {
+			if state.Healthy {
+				healthy++
+			}
+			replica := map[string]any{
+				"healthy":    state.Healthy,
+				"lag_ms":     float64(state.Lag.Microseconds()) / 1000,
+				"checked_at": state.CheckedAt,
+				"pool": map[string]any{
+					"max_conns":               state.Pool.MaxConns,
+					"total_conns":             state.Pool.TotalConns,
+					"acquired_conns":          state.Pool.AcquiredConns,
+					"idle_conns":              state.Pool.IdleConns,
+					"acquire_count":           state.Pool.AcquireCount,
+					"empty_acquire_count":     state.Pool.EmptyAcquireCount,
+					"empty_acquire_wait_time": state.Pool.EmptyAcquireWaitTime,
+				},
+			}
+			if state.Error != "" {
+				replica["error"] = state.Error
+			}
+			details[state.Name] = replica
+		}
+
+		if healthy == 0 {
+			return details, fmt.Errorf("no healthy read replica, reads go to the primary")
+		}
+		return details, nil
+	})
+}
+
+// RedisChecker pings Redis and reports its pool statistics
+func RedisChecker() HealthChecker {
+	return CheckerFunc(func(ctx context.Context) (map[string]any, error) {
+		if err := db.HealthCheckRedis(ctx); err != nil {
+			return nil, err
+		}
+
+		stats := db.GetRedis().PoolStats()
+		return map[string]any{
+			"hits":        stats.Hits,
+			"misses":      stats.Misses,
+			"timeouts":    stats.Timeouts,
+			"total_conns": stats.TotalConns,
+			"idle_conns":  stats.IdleConns,
+			"stale_conns": stats.StaleConns,
+		}, nil
+	})
+}
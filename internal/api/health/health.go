@@ -0,0 +1,244 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Probe paths served at the root of the main port
+const (
+	LivePath    = "/livez"
+	ReadyPath   = "/readyz"
+	StartupPath = "/startupz"
+)
+
+// IsProbePath reports whether path is one of the probe endpoints
+func IsProbePath(path string) bool {
+	return path == LivePath || path == ReadyPath || path == StartupPath
+}
+
+// Criticality decides how a failing check affects readiness
+type Criticality string
+
+const (
+	// Critical checks make the instance not ready when they fail
+	Critical Criticality = "critical"
+	// Degraded checks are reported but keep the instance ready
+	Degraded Criticality = "degraded"
+)
+
+// Check and report statuses
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+	StatusStarting = "starting"
+	StatusStopping = "stopping"
+)
+
+// HealthChecker checks one dependency. Details are only shown to authenticated callers,
+// so they may contain internals such as connection pool statistics.
+type HealthChecker interface {
+	Check(ctx context.Context) (details map[string]any, err error)
+}
+
+// CheckerFunc adapts a function to HealthChecker
+type CheckerFunc func(ctx context.Context) (map[string]any, error)
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) (map[string]any, error) {
+	return f(ctx)
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status      string         `json:"status"`
+	Criticality Criticality    `json:"criticality"`
+	Error       string         `json:"error,omitempty"`
+	DurationMS  float64        `json:"duration_ms"`
+	CheckedAt   time.Time      `json:"checked_at"`
+	Details     map[string]any `json:"details,omitempty"`
+}
+
+// Report aggregates the results of every registered check
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// check is a registered HealthChecker and its cached result
+type check struct {
+	name        string
+	checker     HealthChecker
+	criticality Criticality
+	timeout     time.Duration
+
+	mu     sync.Mutex
+	result *CheckResult
+}
+
+// Registry runs the registered checks and caches their results for cacheTTL,
+// so frequent probes from several sources do not ping the dependencies each time
+type Registry struct {
+	cacheTTL       time.Duration
+	defaultTimeout time.Duration
+
+	mu     sync.RWMutex
+	checks []*check
+
+	started  atomic.Bool
+	stopping atomic.Bool
+}
+
+// NewRegistry creates an empty registry. defaultTimeout applies to checks registered without one.
+func NewRegistry(cacheTTL, defaultTimeout time.Duration) *Registry {
+	return &Registry{cacheTTL: cacheTTL, defaultTimeout: defaultTimeout}
+}
+
+// Register adds a check. A timeout of 0 uses the registry default.
+func (r *Registry) Register(name string, criticality Criticality, timeout time.Duration, checker HealthChecker) {
+	if timeout <= 0 {
+		timeout = r.defaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.checks {
+		if c.name == name {
+			panic(fmt.Sprintf("health check %q registered twice", name))
+		}
+	}
+	// Copy so that a concurrent run keeps iterating over the previous slice
+	checks := append(append([]*check{}, r.checks...), &check{name: name, checker: checker, criticality: criticality, timeout: timeout})
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+	r.checks = checks
+}
+
+// MarkStarted records that initialization finished, see Startup
+func (r *Registry) MarkStarted() {
+	r.started.Store(true)
+}
+
+// MarkStopping records that shutdown began, so Ready fails while requests drain
+func (r *Registry) MarkStopping() {
+	r.stopping.Store(true)
+}
+
+// Live reports whether the process is able to serve requests at all. It never runs checks:
+// a failing dependency must not get the instance restarted.
+func (r *Registry) Live() Report {
+	return Report{Status: StatusOK}
+}
+
+// Ready runs the checks. The report is down when a critical check fails or shutdown began,
+// and degraded when only degraded checks fail.
+func (r *Registry) Ready(ctx context.Context) Report {
+	report := r.run(ctx)
+	if r.stopping.Load() {
+		report.Status = StatusStopping
+	}
+	return report
+}
+
+// Startup reports starting until MarkStarted is called, then behaves like Ready
+func (r *Registry) Startup(ctx context.Context) Report {
+	if !r.started.Load() {
+		return Report{Status: StatusStarting}
+	}
+	return r.Ready(ctx)
+}
+
+// Healthy reports whether a report should be answered with 200
+func (rep Report) Healthy() bool {
+	return rep.Status == StatusOK || rep.Status == StatusDegraded
+}
+
+// run executes the checks concurrently, reusing results younger than cacheTTL
+func (r *Registry) run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := r.checks
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.result(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		result := results[i]
+		report.Checks[c.name] = result
+		if result.Status == StatusOK {
+			continue
+		}
+		if c.criticality == Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// result returns the cached result of c, or runs it. Holding the check lock while running
+// means concurrent probes wait for a single execution instead of each pinging the dependency.
+func (r *Registry) result(ctx context.Context, c *check) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.result != nil && time.Since(c.result.CheckedAt) < r.cacheTTL {
+		return *c.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := runCheck(checkCtx, c.checker)
+	duration := time.Since(start)
+
+	result := CheckResult{
+		Status:      StatusOK,
+		Criticality: c.criticality,
+		DurationMS:  float64(duration.Microseconds()) / 1000,
+		CheckedAt:   start,
+		Details:     details,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	c.result = &result
+	return result
+}
+
+// runCheck runs checker, failing when it outlives ctx even if it ignores cancellation
+func runCheck(ctx context.Context, checker HealthChecker) (map[string]any, error) {
+	type outcome struct {
+		details map[string]any
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := checker.Check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.details, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
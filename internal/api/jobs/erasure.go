@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-boilerplate-api/shared/models"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// erasureBatchSize is the number of users anonymized per transaction
+const erasureBatchSize = 100
+
+// The advisory lock letting a single instance run the erasure job at a time, in the two int4
+// key form of the migration lock under a class of its own
+const (
+	erasureLockClass = 0x6a6f6273 // "jobs"
+	erasureLockID    = 1
+)
+
+// StartErasureJob runs RunErasure every interval until ctx is cancelled, logging through the
+// logger of ctx. A run is skipped while another instance holds the erasure lock.
+func StartErasureJob(ctx context.Context, gormDB *gorm.DB, interval, gracePeriod time.Duration) {
+	log := zerolog.Ctx(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			erased, acquired, err := runErasureWithLock(ctx, gormDB, gracePeriod)
+			if err != nil {
+				log.Error().Err(err).Msg("Erasure job failed")
+			} else if !acquired {
+				log.Debug().Msg("Erasure job skipped, another instance is running it")
+			} else if erased > 0 {
+				log.Info().Int("users", erased).Msg("Erasure job anonymized users")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runErasureWithLock runs RunErasure while holding the erasure lock on a dedicated connection
+// of the primary. acquired is false when another instance holds the lock.
+func runErasureWithLock(ctx context.Context, gormDB *gorm.DB, gracePeriod time.Duration) (erased int, acquired bool, err error) {
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	// Session level advisory locks belong to one connection, so hold a dedicated one
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", erasureLockClass, erasureLockID).Scan(&acquired)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to acquire erasure lock: %w", err)
+	}
+	if !acquired {
+		return 0, false, nil
+	}
+	defer func() {
+		// A fresh context so the lock is released even when ctx was cancelled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1, $2)", erasureLockClass, erasureLockID); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to release erasure lock, it is released when the connection closes")
+		}
+	}()
+
+	erased, err = RunErasure(ctx, gormDB, gracePeriod)
+	return erased, true, err
+}
+
+// RunErasure anonymizes users that were soft deleted more than gracePeriod ago.
+// The user row is kept so that references to it stay valid, but every piece of
+// personal data is overwritten and related sessions and email changes are removed.
+func RunErasure(ctx context.Context, gormDB *gorm.DB, gracePeriod time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-gracePeriod)
+	total := 0
+
+	for {
+		// A lagging replica would return users anonymized by the previous batch again
+		var users []models.User
+		err := gormDB.WithContext(ctx).Unscoped().Clauses(dbresolver.Write).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ? AND anonymized_at IS NULL", cutoff).
+			Limit(erasureBatchSize).
+			Find(&users).Error
+		if err != nil {
+			return total, fmt.Errorf("failed to find users to erase: %w", err)
+		}
+		if len(users) == 0 {
+			return total, nil
+		}
+
+		for _, user := range users {
+			anonymized, err := anonymizeUser(ctx, gormDB, user.ID)
+			if err != nil {
+				return total, err
+			}
+			if anonymized {
+				total++
+			}
+		}
+	}
+}
+
+// anonymizeUser overwrites the PII of a single user. It reports false when the user was
+// restored or anonymized since it was selected, and then changes nothing.
+func anonymizeUser(ctx context.Context, gormDB *gorm.DB, userID string) (bool, error) {
+	anonymized := false
+	err := gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.User{}).
+			Where("id = ? AND deleted_at IS NOT NULL AND anonymized_at IS NULL", userID).
+			Updates(map[string]interface{}{
+				"email":             fmt.Sprintf("erased-%s@erased.invalid", userID),
+				"first_name":        nil,
+				"last_name":         nil,
+				"password_hash":     "",
+				"email_verified_at": nil,
+				"anonymized_at":     time.Now().UTC(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to anonymize user %s: %w", userID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		anonymized = true
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+			return fmt.Errorf("failed to delete sessions of user %s: %w", userID, err)
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.EmailChangeRequest{}).Error; err != nil {
+			return fmt.Errorf("failed to delete email changes of user %s: %w", userID, err)
+		}
+
+		return nil
+	})
+	return anonymized && err == nil, err
+}
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"context"
+	"io"
+	stdlog "log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// localsKey is the fiber.Ctx locals key holding the request logger
+const localsKey = "logger"
+
+// Options configures the application logger
+type Options struct {
+	// Level is the minimum level logged. It is applied globally so it can change at runtime.
+	Level zerolog.Level
+	// Format is FormatJSON or FormatConsole
+	Format string
+	// SampleEvery keeps one of every N debug and info events, 0 or 1 keeps all of them.
+	// Warnings and errors are never sampled.
+	SampleEvery uint32
+	// Output defaults to os.Stderr
+	Output io.Writer
+}
+
+// New builds a logger from opts
+func New(opts Options) zerolog.Logger {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	if opts.Format == FormatConsole {
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	}
+
+	logger := zerolog.New(out).With().Timestamp().Logger()
+	if opts.SampleEvery > 1 {
+		sampler := &zerolog.BasicSampler{N: opts.SampleEvery}
+		logger = logger.Sample(zerolog.LevelSampler{
+			TraceSampler: sampler,
+			DebugSampler: sampler,
+			InfoSampler:  sampler,
+		})
+	}
+	return logger
+}
+
+// Init builds the application logger from opts and returns it to be injected, through
+// Middleware and the contexts given to the other packages. It also becomes the zerolog
+// global logger, the logger returned by zerolog.Ctx for contexts without one, and the output
+// of the standard library logger, so third-party log lines share the same format.
+func Init(opts Options) zerolog.Logger {
+	zerolog.SetGlobalLevel(opts.Level)
+
+	logger := New(opts)
+	log.Logger = logger
+	zerolog.DefaultContextLogger = &log.Logger
+
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(logger)
+	return logger
+}
+
+// SetLevel changes the minimum level of every logger
+func SetLevel(level zerolog.Level) {
+	zerolog.SetGlobalLevel(level)
+}
+
+// Middleware attaches a logger derived from base carrying the request ID, and the trace and
+// span IDs when the request is traced, to each request. It must run after the requestid and
+// tracing middleware.
+func Middleware(base zerolog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := base.With()
+		if requestID, ok := c.Locals("requestid").(string); ok && requestID != "" {
+			ctx = ctx.Str("request_id", requestID)
+		}
+		if spanContext := trace.SpanContextFromContext(c.UserContext()); spanContext.IsValid() {
+			ctx = ctx.Str("trace_id", spanContext.TraceID().String()).
+				Str("span_id", spanContext.SpanID().String())
+		}
+		logger := ctx.Logger()
+
+		c.Locals(localsKey, &logger)
+		c.SetUserContext(logger.WithContext(c.UserContext()))
+		return c.Next()
+	}
+}
+
+// FromCtx returns the request logger, or the application logger outside of Middleware
+func FromCtx(c *fiber.Ctx) *zerolog.Logger {
+	if logger, ok := c.Locals(localsKey).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
+}
+
+// FromLocals returns the request logger stored in the locals of a request, or of a websocket
+// connection upgraded from it, or the application logger
+func FromLocals(locals func(key string) interface{}) *zerolog.Logger {
+	if logger, ok := locals(localsKey).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
+}
+
+// FromContext returns the logger stored in ctx by Middleware, or the application logger
+func FromContext(ctx context.Context) *zerolog.Logger {
+	return zerolog.Ctx(ctx)
+}
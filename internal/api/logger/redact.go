@@ -0,0 +1,225 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logs
+const Redacted = "[REDACTED]"
+
+// maxRedactBodyBytes is the largest body parsed for redaction, bigger bodies are never logged
+const maxRedactBodyBytes = 1 << 20
+
+// RedactionRules selects what is redacted from logged headers, query strings and bodies
+type RedactionRules struct {
+	// Headers are header names redacted entirely, case-insensitive
+	Headers []string
+	// Fields redact any query, form or JSON key containing one of them, case-insensitive.
+	// "token" matches token, access_token and refreshToken.
+	Fields []string
+	// Paths redact exact JSON paths, dot separated with * matching any key or array index,
+	// e.g. user.phone or items.*.card_number
+	Paths []string
+}
+
+// DefaultRedactionRules are always applied
+func DefaultRedactionRules() RedactionRules {
+	return RedactionRules{
+		Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		Fields:  []string{"password", "token", "secret", "authorization", "cookie", "email", "username"},
+	}
+}
+
+// Merge returns the rules with other appended
+func (r RedactionRules) Merge(other RedactionRules) RedactionRules {
+	return RedactionRules{
+		Headers: append(append([]string{}, r.Headers...), other.Headers...),
+		Fields:  append(append([]string{}, r.Fields...), other.Fields...),
+		Paths:   append(append([]string{}, r.Paths...), other.Paths...),
+	}
+}
+
+// Redactor removes sensitive values before they are logged
+type Redactor struct {
+	headers map[string]bool
+	fields  []string
+	paths   [][]string
+}
+
+// NewRedactor builds a redactor from rules. Empty entries are ignored.
+func NewRedactor(rules RedactionRules) *Redactor {
+	r := &Redactor{headers: map[string]bool{}}
+	for _, header := range rules.Headers {
+		if header = strings.TrimSpace(header); header != "" {
+			r.headers[strings.ToLower(header)] = true
+		}
+	}
+	for _, field := range rules.Fields {
+		if field = normalizeKey(field); field != "" {
+			r.fields = append(r.fields, field)
+		}
+	}
+	for _, path := range rules.Paths {
+		if path = strings.TrimSpace(path); path != "" {
+			r.paths = append(r.paths, strings.Split(path, "."))
+		}
+	}
+	return r
+}
+
+// normalizeKey lowercases a key and drops separators so access_token, accessToken and
+// Access-Token compare equal
+func normalizeKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.NewReplacer("_", "", "-", "", ".", "").Replace(key)
+}
+
+// sensitiveKey reports whether a query, form or JSON key matches a field rule
+func (r *Redactor) sensitiveKey(key string) bool {
+	key = normalizeKey(key)
+	for _, field := range r.fields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns value, or Redacted when the header is sensitive
+func (r *Redactor) Header(name, value string) string {
+	if r.headers[strings.ToLower(name)] || r.sensitiveKey(name) {
+		return Redacted
+	}
+	return value
+}
+
+// Headers returns a copy of headers with sensitive values redacted
+func (r *Redactor) Headers(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = r.Header(name, value)
+	}
+	return redacted
+}
+
+// Query redacts the sensitive parameters of a raw query string.
+// A query that cannot be parsed is redacted entirely.
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+	for key := range values {
+		if r.sensitiveKey(key) {
+			values[key] = []string{Redacted}
+		}
+	}
+	return values.Encode()
+}
+
+// Body returns a loggable form of a request or response body, at most maxBytes long.
+// JSON and form bodies are redacted; other content types, invalid JSON and bodies too
+// large to parse are replaced with a placeholder so nothing unredacted is logged.
+func (r *Redactor) Body(contentType string, body []byte, maxBytes int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxRedactBodyBytes {
+		return fmt.Sprintf("[%d bytes, too large to log]", len(body))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var redacted string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Sprintf("[%d bytes, invalid JSON]", len(body))
+		}
+		out, err := json.Marshal(r.redactJSON(value, nil))
+		if err != nil {
+			return fmt.Sprintf("[%d bytes]", len(body))
+		}
+		redacted = string(out)
+	case mediaType == "application/x-www-form-urlencoded":
+		redacted = r.Query(string(body))
+	default:
+		return fmt.Sprintf("[%d bytes, %s]", len(body), mediaTypeOrUnknown(mediaType))
+	}
+
+	return truncate(redacted, maxBytes)
+}
+
+func mediaTypeOrUnknown(mediaType string) string {
+	if mediaType == "" {
+		return "unknown content type"
+	}
+	return mediaType
+}
+
+// truncate cuts s to maxBytes, noting the original size. maxBytes <= 0 means no limit.
+func truncate(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+	return s[:maxBytes] + "...[truncated " + strconv.Itoa(len(s)) + " bytes]"
+}
+
+// redactJSON walks a decoded JSON value, path holds the keys leading to it
+func (r *Redactor) redactJSON(value any, path []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := append(path[:len(path):len(path)], key)
+			if r.sensitiveKey(key) || r.matchPath(childPath) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = r.redactJSON(child, childPath)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			childPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if r.matchPath(childPath) {
+				v[i] = Redacted
+				continue
+			}
+			v[i] = r.redactJSON(child, childPath)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// matchPath reports whether path matches a path rule
+func (r *Redactor) matchPath(path []string) bool {
+	for _, rule := range r.paths {
+		if len(rule) != len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range rule {
+			if segment != "*" && !strings.EqualFold(segment, path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
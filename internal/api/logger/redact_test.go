@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactorHeader(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules().Merge(RedactionRules{Headers: []string{"X-Internal-Key"}}))
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Authorization", "Bearer abc.def.ghi", Redacted},
+		{"authorization", "Bearer abc.def.ghi", Redacted},
+		{"Cookie", "session=abc", Redacted},
+		{"X-Internal-Key", "k-123", Redacted},
+		{"X-CSRF-Token", "csrf-123", Redacted},
+		{"Content-Type", "application/json", "application/json"},
+	}
+	for _, tt := range tests {
+		if got := r.Header(tt.name, tt.value); got != tt.want {
+			t.Errorf("Header(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorQuery(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+
+	got := r.Query("access_token=tok-123&page=2&email=jane%40example.com&refreshToken=tok-456")
+	for _, secret := range []string{"tok-123", "tok-456", "jane"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Query() = %q, contains %q", got, secret)
+		}
+	}
+	if !strings.Contains(got, "page=2") {
+		t.Errorf("Query() = %q, want page=2 kept", got)
+	}
+
+	if got := r.Query("%zz"); got != Redacted {
+		t.Errorf("Query(invalid) = %q, want %q", got, Redacted)
+	}
+}
+
+func TestRedactorBodyJSON(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules().Merge(RedactionRules{
+		Fields: []string{"ssn"},
+		Paths:  []string{"profile.phone", "cards.*.number"},
+	}))
+
+	body := `{
+		"email": "jane@example.com",
+		"password": "hunter2",
+		"new_password": "hunter3",
+		"profile": {"phone": "555-0100", "city": "Manila", "ssn": "123-45-6789"},
+		"cards": [{"number": "4111111111111111", "brand": "visa"}],
+		"session": {"token": "tok-123", "client_secret": "cs-456"}
+	}`
+
+	got := r.Body("application/json; charset=utf-8", []byte(body), 0)
+	for _, secret := range []string{"jane@example.com", "hunter2", "hunter3", "555-0100", "123-45-6789", "4111111111111111", "tok-123", "cs-456"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Body() = %s, contains %q", got, secret)
+		}
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("Body() = %s, not valid JSON: %v", got, err)
+	}
+	if city := decoded["profile"].(map[string]any)["city"]; city != "Manila" {
+		t.Errorf("profile.city = %v, want Manila", city)
+	}
+	if brand := decoded["cards"].([]any)[0].(map[string]any)["brand"]; brand != "visa" {
+		t.Errorf("cards.0.brand = %v, want visa", brand)
+	}
+}
+
+func TestRedactorBodyForm(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+
+	got := r.Body("application/x-www-form-urlencoded", []byte("username=jane&password=hunter2"), 0)
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("Body() = %q, contains the password", got)
+	}
+	// Login sends the email as the username
+	if strings.Contains(got, "jane") {
+		t.Errorf("Body() = %q, contains the username", got)
+	}
+}
+
+func TestRedactorBodyNeverLogsUnparsedContent(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"password": "hunter2"`},
+		{"text/plain", "password=hunter2"},
+		{"", "password=hunter2"},
+		{"multipart/form-data; boundary=x", "--x\r\npassword=hunter2"},
+	}
+	for _, tt := range tests {
+		if got := r.Body(tt.contentType, []byte(tt.body), 0); strings.Contains(got, "hunter2") {
+			t.Errorf("Body(%q) = %q, contains the password", tt.contentType, got)
+		}
+	}
+
+	large := `{"password": "hunter2", "data": "` + strings.Repeat("a", maxRedactBodyBytes) + `"}`
+	if got := r.Body("application/json", []byte(large), 0); strings.Contains(got, "hunter2") || strings.Contains(got, "aaaa") {
+		t.Errorf("Body(large) = %.80q, want a placeholder", got)
+	}
+}
+
+func TestRedactorBodyTruncates(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+
+	body := `{"data": "` + strings.Repeat("a", 100) + `"}`
+	got := r.Body("application/json", []byte(body), 20)
+	if !strings.HasPrefix(got, `{"data":"aaaaaaaaaaa`) || !strings.HasSuffix(got, "...[truncated 111 bytes]") {
+		t.Errorf("Body() = %q, want the first 20 bytes and a truncation note", got)
+	}
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go-boilerplate-api/internal/api/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// postgresCollector exports the stats of the shared pgx pool on every scrape
+type postgresCollector struct {
+	maxConns          *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	acquireCount      *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	canceledCount     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newPostgresCollector() *postgresCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("db_pool_"+name, help, nil, nil)
+	}
+	return &postgresCollector{
+		maxConns:          desc("max_open_connections", "Maximum number of connections to the database."),
+		open:              desc("open_connections", "Established connections, both in use and idle."),
+		inUse:             desc("in_use_connections", "Connections currently in use."),
+		idle:              desc("idle_connections", "Idle connections."),
+		acquireCount:      desc("acquire_count_total", "Connections acquired from the pool."),
+		waitCount:         desc("wait_count_total", "Connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time blocked waiting for a connection."),
+		canceledCount:     desc("canceled_acquire_count_total", "Acquires cancelled while waiting for a connection."),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "Connections closed due to DB_MAX_CONN_IDLE_TIME."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Connections closed due to DB_MAX_CONN_LIFETIME."),
+	}
+}
+
+func (c *postgresCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxConns
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.acquireCount
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.canceledCount
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *postgresCollector) Collect(ch chan<- prometheus.Metric) {
+	stat, err := db.GetPoolStat()
+	if err != nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stat.EmptyAcquireWaitTime().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.canceledCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(stat.MaxIdleDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stat.MaxLifetimeDestroyCount()))
+}
+
+// redisCollector exports the go-redis pool stats of db.RedisClient on every scrape
+type redisCollector struct {
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func newRedisCollector() *redisCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("redis_pool_"+name, help, nil, nil)
+	}
+	return &redisCollector{
+		hits:       desc("hits_total", "Times a free connection was found in the pool."),
+		misses:     desc("misses_total", "Times a free connection was not found in the pool."),
+		timeouts:   desc("timeouts_total", "Times a wait for a connection timed out."),
+		totalConns: desc("total_connections", "Connections in the pool."),
+		idleConns:  desc("idle_connections", "Idle connections in the pool."),
+		staleConns: desc("stale_connections_total", "Stale connections removed from the pool."),
+	}
+}
+
+func (c *redisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+func (c *redisCollector) Collect(ch chan<- prometheus.Metric) {
+	client := db.GetRedis()
+	if client == nil {
+		return
+	}
+	stats := client.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
+
+// migrationCollector exports the schema_migrations version on every scrape
+type migrationCollector struct {
+	version *prometheus.Desc
+	dirty   *prometheus.Desc
+}
+
+func newMigrationCollector() *migrationCollector {
+	return &migrationCollector{
+		version: prometheus.NewDesc("db_migration_version", "Current database migration version.", nil, nil),
+		dirty:   prometheus.NewDesc("db_migration_dirty", "1 if the last migration failed and needs manual intervention.", nil, nil),
+	}
+}
+
+func (c *migrationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.version
+	ch <- c.dirty
+}
+
+func (c *migrationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	version, dirty, err := db.CurrentMigrationVersion(ctx)
+	if err != nil {
+		return
+	}
+
+	dirtyValue := 0.0
+	if dirty {
+		dirtyValue = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.version, prometheus.GaugeValue, float64(version))
+	ch <- prometheus.MustNewConstMetric(c.dirty, prometheus.GaugeValue, dirtyValue)
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"go-boilerplate-api/shared/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests that matched no route, so unknown paths cannot
+// create unbounded label values
+const unmatchedRoute = "unmatched"
+
+// Registry holds every metric exported on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+
+	rateLimitRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		httpRequestsInFlight,
+		rateLimitRejections,
+		newPostgresCollector(),
+		newRedisCollector(),
+		newMigrationCollector(),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware records the request counters and latency histograms
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		route := helpers.RouteTemplate(c, status)
+		if route == "" {
+			route = unmatchedRoute
+		}
+		labels := prometheus.Labels{
+			"method": c.Method(),
+			"route":  route,
+			"status": strconv.Itoa(status),
+		}
+		httpRequests.With(labels).Inc()
+		httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// RateLimitRejected counts a request rejected by the rate limiter
+func RateLimitRejected() {
+	rateLimitRejections.Inc()
+}
+
+// RegisterGaugeFunc exports the value returned by fn on every scrape
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// RegisterCounterFunc exports the value returned by fn, which must only increase, on every scrape
+func RegisterCounterFunc(name, help string, labels prometheus.Labels, fn func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels}, fn))
+}
@@ -1,16 +1,34 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/internal/api/logger"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
-func Protected(c *fiber.Ctx) error {
+// sessionTouchInterval limits how often last_seen_at is written for a session
+const sessionTouchInterval = time.Minute
+
+// Protected validates the bearer token and its session before calling the next handler
+func Protected(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return authenticate(c, cfg)
+	}
+}
+
+func authenticate(c *fiber.Ctx, cfg *config.Config) error {
 	// Get Authorization header
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -32,7 +50,7 @@ func Protected(c *fiber.Ctx) error {
 	tokenString := parts[1]
 
 	// Validate secret key is configured
-	if config.SECRET_KEY == "" {
+	if cfg.SecretKey == "" {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "internal_error",
 			"message": "Server configuration error",
@@ -46,7 +64,7 @@ func Protected(c *fiber.Ctx) error {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return []byte(config.SECRET_KEY), nil
+		return []byte(cfg.SecretKey), nil
 	})
 
 	if err != nil {
@@ -57,15 +75,130 @@ func Protected(c *fiber.Ctx) error {
 	}
 
 	// Extract and validate claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Store claims in context for later use
-		c.Locals("user", claims)
-	} else {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   "unauthorized",
 			"message": "Invalid token claims",
 		})
 	}
 
+	subjectID, _ := claims["sub"].(string)
+	actorID := helpers.ActorFromClaims(claims)
+	sessionID, _ := claims["sid"].(string)
+
+	// Reject tokens whose session was revoked or has expired.
+	// Impersonation tokens are bound to the session of the actor.
+	if err := validateSession(c, actorID, sessionID); err != nil {
+		if errors.Is(err, errSessionInactive) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "unauthorized",
+				"message": "Session has been revoked or has expired",
+			})
+		}
+		if errors.Is(err, errNoDatabase) {
+			return helpers.SendError(c, fiber.StatusServiceUnavailable, "service_unavailable", "Database is not configured")
+		}
+		return err
+	}
+
+	// An impersonation token stops working once its subject is disabled or deleted
+	if actorID != subjectID {
+		if err := validateSubject(c, subjectID); err != nil {
+			if errors.Is(err, errSubjectInactive) {
+				return helpers.SendForbidden(c, "Impersonated account is not active")
+			}
+			return err
+		}
+	}
+
+	// Reads stay on the primary after a recent write by the same user, from any device
+	db.ReadYourWritesFromContext(c.UserContext()).Resume(c.UserContext(), subjectID)
+
+	// Store claims in context for later use
+	c.Locals("user", claims)
+	c.Locals("subject_id", subjectID)
+	c.Locals("actor_id", actorID)
+
+	if actorID != subjectID {
+		return auditImpersonatedRequest(c, actorID, subjectID, sessionID)
+	}
+
 	return c.Next()
 }
+
+var (
+	errSessionInactive = errors.New("session is not active")
+	errSubjectInactive = errors.New("impersonated user is not active")
+	errNoDatabase      = errors.New("database is not configured")
+)
+
+// validateSubject checks that the user an impersonation token acts as is still active.
+// Soft deleted users are excluded by the default scope. validateSession runs first, so the
+// database is configured.
+func validateSubject(c *fiber.Ctx, subjectID string) error {
+	var subject models.User
+	err := db.DB.WithContext(c.UserContext()).Clauses(dbresolver.Write).
+		Select("id", "status").
+		First(&subject, "id = ?", subjectID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errSubjectInactive
+	}
+	if err != nil {
+		return err
+	}
+	if subject.Status != models.UserStatusActive {
+		return errSubjectInactive
+	}
+	return nil
+}
+
+// validateSession checks the session referenced by the sid claim and records activity on it.
+// Without a database sessions cannot be checked, so every token is rejected.
+func validateSession(c *fiber.Ctx, userID, sessionID string) error {
+	if db.DB == nil {
+		return errNoDatabase
+	}
+
+	if userID == "" || sessionID == "" {
+		return errSessionInactive
+	}
+
+	gormDB := db.DB.WithContext(c.UserContext())
+
+	// A revocation must apply immediately, so the session is never read from a lagging replica
+	var session models.Session
+	err := gormDB.Clauses(dbresolver.Write).Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errSessionInactive
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if !session.IsActive(now) {
+		return errSessionInactive
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		// The touch does not send the user's reads to the primary
+		touchDB := gormDB.WithContext(db.WithoutReadYourWrites(c.UserContext()))
+		if err := touchDB.Model(&session).Update("last_seen_at", now).Error; err != nil {
+			logger.FromCtx(c).Warn().Err(err).Str("session_id", session.ID).Msg("Failed to update session last_seen_at")
+		}
+	}
+
+	return nil
+}
+
+// OptionalProtected authenticates requests that carry an Authorization header and lets
+// anonymous requests through. Handlers tell them apart with c.Locals("user").
+func OptionalProtected(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
+		}
+		return authenticate(c, cfg)
+	}
+}
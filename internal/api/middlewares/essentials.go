@@ -1,14 +1,19 @@
 package middlewares
 
 import (
-	"log"
-	"os"
+	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go-boilerplate-api/internal/api/config"
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/internal/api/health"
+	"go-boilerplate-api/internal/api/metrics"
+	"go-boilerplate-api/internal/api/tracing"
 
-	"github.com/gofiber/contrib/fiberzerolog"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -19,25 +24,57 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func SetupMiddlewaresEssentials(app *fiber.App) {
-	SetupMiddlewareRecover(app)
+// SetupMiddlewaresEssentials registers the base middleware stack.
+// When reloader is not nil, the CORS allowlist and rate limits follow configuration reloads.
+// Request loggers derive from log.
+func SetupMiddlewaresEssentials(app *fiber.App, cfg *config.Config, reloader *config.Reloader, log zerolog.Logger) {
+	SetupMiddlewareMetrics(app, cfg)
+	SetupMiddlewareRecover(app, cfg)
+	SetupMiddlewareTracing(app, cfg)
 	SetupMiddlewareRequestID(app)
+	SetupMiddlewareRequestLogger(app, log)
+	SetupMiddlewareQueryStats(app, cfg)
+	SetupMiddlewareReadYourWrites(app, cfg)
 	SetupMiddlewareHelmet(app)
-	SetupMiddlewareCORS(app)
-	SetupMiddlewareRateLimiter(app)
+	SetupMiddlewareCORS(app, cfg, reloader, log)
+	SetupMiddlewareRateLimiter(app, cfg, reloader)
 	SetupMiddlewareCompress(app)
-	SetupMiddlewareFiberZerolog(app)
+	SetupMiddlewareFiberZerolog(app, cfg)
+}
+
+// SetupMiddlewareMetrics records request counters and latency, including recovered panics
+func SetupMiddlewareMetrics(app *fiber.App, cfg *config.Config) {
+	if cfg.MetricsEnabled {
+		app.Use(metrics.Middleware())
+	}
 }
 
 // SetupMiddlewareRecover recovers from panics and prevents server crashes
-func SetupMiddlewareRecover(app *fiber.App) {
+func SetupMiddlewareRecover(app *fiber.App, cfg *config.Config) {
 	app.Use(recover.New(recover.Config{
-		EnableStackTrace: !config.IS_PROD, // Only show stack traces in development
+		EnableStackTrace: cfg.StackTraces, // Only show stack traces when enabled for the profile
+	}))
+}
+
+// SetupMiddlewareTracing starts a span per request, continuing incoming W3C trace context.
+// Probes and metrics scrapes are not traced.
+func SetupMiddlewareTracing(app *fiber.App, cfg *config.Config) {
+	app.Use(tracing.Middleware(func(c *fiber.Ctx) bool {
+		return health.IsProbePath(c.Path()) || (cfg.MetricsEnabled && c.Path() == cfg.MetricsPath)
 	}))
 }
 
-// SetupMiddlewareRequestID adds unique request ID to each request
+// SetupMiddlewareRequestID adds unique request ID to each request.
+// Traced requests without an X-Request-ID header use their trace ID.
 func SetupMiddlewareRequestID(app *fiber.App) {
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderXRequestID) == "" {
+			if traceID := tracing.TraceID(c.UserContext()); traceID != "" {
+				c.Request().Header.Set(fiber.HeaderXRequestID, traceID)
+			}
+		}
+		return c.Next()
+	})
 	app.Use(requestid.New())
 }
 
@@ -48,6 +85,47 @@ func SetupMiddlewareCompress(app *fiber.App) {
 	}))
 }
 
+// SetupMiddlewareQueryStats counts the queries of each request for the N+1 detector and,
+// with DB_QUERY_STATS_HEADER, reports them in the X-Query-Count and X-Query-Duration headers.
+// It must run after the request logger so N+1 warnings carry the request ID.
+func SetupMiddlewareQueryStats(app *fiber.App, cfg *config.Config) {
+	if !cfg.DBQueryStatsHeader && cfg.DBNPlusOneThreshold == 0 {
+		return
+	}
+
+	app.Use(func(c *fiber.Ctx) error {
+		ctx, stats := db.WithQueryStats(c.UserContext())
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		if cfg.DBQueryStatsHeader {
+			c.Set("X-Query-Count", strconv.Itoa(stats.Count()))
+			c.Set("X-Query-Duration", strconv.FormatFloat(float64(stats.Duration().Microseconds())/1000, 'f', 3, 64)+"ms")
+		}
+		return err
+	})
+}
+
+// SetupMiddlewareReadYourWrites sends the reads of a request to the primary for
+// DB_REPLICA_STICKY_WINDOW after a write. Protected extends it to the following requests of
+// the same user. It is only installed with read replicas.
+func SetupMiddlewareReadYourWrites(app *fiber.App, cfg *config.Config) {
+	if len(cfg.ReplicaURLs()) == 0 || cfg.DBReplicaStickyWindow == 0 {
+		return
+	}
+
+	app.Use(func(c *fiber.Ctx) error {
+		ctx, tracker := db.WithReadYourWrites(c.UserContext(), cfg.DBReplicaStickyWindow)
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		tracker.Save(ctx)
+		return err
+	})
+}
+
 // SetupMiddlewareHelmet sets security headers
 func SetupMiddlewareHelmet(app *fiber.App) {
 	app.Use(helmet.New(helmet.Config{
@@ -64,19 +142,55 @@ func SetupMiddlewareHelmet(app *fiber.App) {
 	}))
 }
 
-// SetupMiddlewareCORS configures CORS based on environment
-func SetupMiddlewareCORS(app *fiber.App) {
-	origins := config.ALLOWED_ORIGINS
+// SetupMiddlewareCORS configures CORS based on environment.
+// The allowlist is re-read when ALLOWED_ORIGINS is reloaded.
+func SetupMiddlewareCORS(app *fiber.App, cfg *config.Config, reloader *config.Reloader, log zerolog.Logger) {
+	originList, err := corsOrigins(cfg, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid CORS configuration")
+	}
+
+	allowed := &atomic.Pointer[map[string]bool]{}
+	allowed.Store(originSet(originList))
+
+	if reloader != nil {
+		reloader.Subscribe(func(next *config.Config) (func(), error) {
+			originList, err := corsOrigins(next, log)
+			if err != nil {
+				return nil, err
+			}
+			set := originSet(originList)
+			return func() { allowed.Store(set) }, nil
+		})
+	}
+
+	// When AllowCredentials is true, cannot use wildcard "*"
+	// Must specify exact origins, checked through AllowOriginsFunc so they can change at runtime
+	corsConfig := cors.Config{
+		AllowOriginsFunc: func(origin string) bool {
+			return (*allowed.Load())[normalizeOrigin(origin)]
+		},
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS,HEAD",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Accept-Language,Content-Length",
+		AllowCredentials: true,
+		MaxAge:           3600, // 1 hour
+	}
+
+	app.Use(cors.New(corsConfig))
+}
+
+// corsOrigins parses ALLOWED_ORIGINS, falling back to http://localhost:3000 unless STRICT_CORS is set
+func corsOrigins(cfg *config.Config, log zerolog.Logger) ([]string, error) {
+	origins := cfg.AllowedOrigins
 	originList := []string{}
 
 	if origins == "" {
-		if config.IS_PROD {
-			// In production, require explicit configuration
-			log.Fatalf("FATAL: ALLOWED_ORIGINS must be set in production. Cannot use default origins when IS_PROD=true")
-		} else {
-			// Development default
-			origins = "http://localhost:3000"
+		if cfg.StrictCORS {
+			// Strict profiles require explicit configuration
+			return nil, fmt.Errorf("ALLOWED_ORIGINS must be set. Cannot use default origins when STRICT_CORS=true")
 		}
+		// Development default
+		origins = "http://localhost:3000"
 	}
 
 	// Parse comma-separated origins
@@ -90,51 +204,82 @@ func SetupMiddlewareCORS(app *fiber.App) {
 
 	// Validate: cannot use wildcard with credentials
 	if origins == "*" {
-		if config.IS_PROD {
-			log.Fatalf("FATAL: Cannot use wildcard '*' for ALLOWED_ORIGINS in production when AllowCredentials is enabled")
-		} else {
-			log.Printf("WARNING: Wildcard '*' not allowed with AllowCredentials, defaulting to http://localhost:3000")
-			originList = []string{"http://localhost:3000"}
+		if cfg.StrictCORS {
+			return nil, fmt.Errorf("cannot use wildcard '*' for ALLOWED_ORIGINS when STRICT_CORS=true and AllowCredentials is enabled")
 		}
+		log.Warn().Msg("Wildcard '*' not allowed with AllowCredentials, defaulting to http://localhost:3000")
+		originList = []string{"http://localhost:3000"}
 	}
 
 	// If no valid origins after parsing, use development default
 	if len(originList) == 0 {
-		if config.IS_PROD {
-			log.Fatalf("FATAL: No valid origins configured. ALLOWED_ORIGINS must be set in production")
-		} else {
-			originList = []string{"http://localhost:3000"}
+		if cfg.StrictCORS {
+			return nil, fmt.Errorf("no valid origins configured. ALLOWED_ORIGINS must be set when STRICT_CORS=true")
 		}
+		originList = []string{"http://localhost:3000"}
 	}
 
-	// When AllowCredentials is true, cannot use wildcard "*"
-	// Must specify exact origins
-	corsConfig := cors.Config{
-		AllowOrigins:     strings.Join(originList, ","),
-		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS,HEAD",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Accept-Language,Content-Length",
-		AllowCredentials: true,
-		MaxAge:           3600, // 1 hour
+	for _, origin := range originList {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid origin %q in ALLOWED_ORIGINS, expected scheme://host[:port]", origin)
+		}
 	}
 
-	app.Use(cors.New(corsConfig))
+	return originList, nil
+}
+
+func originSet(origins []string) *map[string]bool {
+	set := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		set[normalizeOrigin(origin)] = true
+	}
+	return &set
 }
 
-// SetupMiddlewareRateLimiter prevents abuse and DDoS attacks
-func SetupMiddlewareRateLimiter(app *fiber.App) {
-	// Different limits for production vs development
-	maxRequests := 100 // requests per window
-	if config.IS_PROD {
-		maxRequests = 100 // Adjust based on your needs
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// SetupMiddlewareRateLimiter prevents abuse and DDoS attacks.
+// The limiter is rebuilt when RATE_LIMIT_MAX or RATE_LIMIT_WINDOW is reloaded, which resets the counters.
+func SetupMiddlewareRateLimiter(app *fiber.App, cfg *config.Config, reloader *config.Reloader) {
+	handler := &atomic.Pointer[fiber.Handler]{}
+	current := newRateLimiter(cfg.RateLimitMax, cfg.RateLimitWindow)
+	handler.Store(&current)
+
+	if reloader != nil {
+		maxRequests, window := cfg.RateLimitMax, cfg.RateLimitWindow
+		reloader.Subscribe(func(next *config.Config) (func(), error) {
+			if next.RateLimitMax == maxRequests && next.RateLimitWindow == window {
+				return nil, nil
+			}
+			return func() {
+				maxRequests, window = next.RateLimitMax, next.RateLimitWindow
+				limiter := newRateLimiter(maxRequests, window)
+				handler.Store(&limiter)
+			}, nil
+		})
 	}
 
-	app.Use(limiter.New(limiter.Config{
+	app.Use(func(c *fiber.Ctx) error {
+		return (*handler.Load())(c)
+	})
+}
+
+func newRateLimiter(maxRequests int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		// Probes come from few addresses at a fixed rate and must never be rejected
+		Next: func(c *fiber.Ctx) bool {
+			return health.IsProbePath(c.Path())
+		},
 		Max:        maxRequests,
-		Expiration: 1 * time.Minute,
+		Expiration: window,
 		KeyGenerator: func(c *fiber.Ctx) string {
 			return c.IP() // Rate limit by IP
 		},
 		LimitReached: func(c *fiber.Ctx) error {
+			metrics.RateLimitRejected()
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
 				"error":   "rate_limit_exceeded",
 				"message": "Too many requests, please try again later",
@@ -142,13 +287,5 @@ func SetupMiddlewareRateLimiter(app *fiber.App) {
 		},
 		SkipSuccessfulRequests: false,
 		SkipFailedRequests:     false,
-	}))
-}
-
-// SetupMiddlewareFiberZerolog sets up structured logging
-func SetupMiddlewareFiberZerolog(app *fiber.App) {
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
-	app.Use(fiberzerolog.New(fiberzerolog.Config{
-		Logger: &logger,
-	}))
+	})
 }
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"errors"
+
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/internal/api/logger"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DenyImpersonation blocks sensitive actions for requests made with an impersonation token.
+// It must run after Protected.
+func DenyImpersonation(c *fiber.Ctx) error {
+	if helpers.IsImpersonating(c) {
+		return helpers.SendForbidden(c, "This action is not allowed while impersonating a user")
+	}
+	return c.Next()
+}
+
+// auditImpersonatedRequest records the request in the impersonation audit log, then runs the
+// rest of the chain. A request that cannot be recorded is refused. The status code is filled
+// in once the request has been handled.
+func auditImpersonatedRequest(c *fiber.Ctx, actorID, subjectID, sessionID string) error {
+	if db.DB == nil {
+		return helpers.SendError(c, fiber.StatusServiceUnavailable, "service_unavailable", "Database is not configured")
+	}
+
+	entry := models.ImpersonationAuditLog{
+		ActorID:   actorID,
+		SubjectID: subjectID,
+		SessionID: &sessionID,
+		Action:    models.ImpersonationActionRequest,
+		Method:    c.Method(),
+		Path:      c.Path(),
+		IPAddress: c.IP(),
+		RequestID: c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+	// The audit writes do not send the subject's reads to the primary
+	auditDB := db.DB.WithContext(db.WithoutReadYourWrites(c.UserContext()))
+
+	// status_code stays NULL until the request has been handled
+	if err := auditDB.Omit("StatusCode").Create(&entry).Error; err != nil {
+		logger.FromCtx(c).Error().Err(err).Msg("Failed to write impersonation audit log")
+		return helpers.SendError(c, fiber.StatusServiceUnavailable, "service_unavailable", "Impersonated request could not be audited")
+	}
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+	}
+
+	if auditErr := auditDB.Model(&entry).Update("status_code", status).Error; auditErr != nil {
+		logger.FromCtx(c).Warn().Err(auditErr).Str("audit_log_id", entry.ID).Msg("Failed to record impersonation audit status code")
+	}
+
+	return err
+}
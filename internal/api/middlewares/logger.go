@@ -1,28 +1,77 @@
 package middlewares
 
 import (
+	"strings"
+
 	"go-boilerplate-api/internal/api/config"
-	"os"
+	"go-boilerplate-api/internal/api/health"
+	"go-boilerplate-api/internal/api/logger"
 
 	"github.com/gofiber/contrib/fiberzerolog"
-
-	"github.com/rs/zerolog"
-
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
 )
 
-func SetupLogger(app *fiber.App) {
-	switch config.LOG_LEVEL {
-	case config.LOG_LEVEL_DEBUG:
-		zerolog.SetGlobalLevel(zerolog.TraceLevel)
-	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+// SetupMiddlewareRequestLogger attaches a logger derived from log carrying the request ID to
+// each request, retrieved with logger.FromCtx or logger.FromContext(c.UserContext())
+func SetupMiddlewareRequestLogger(app *fiber.App, log zerolog.Logger) {
+	app.Use(logger.Middleware(log))
+}
+
+// SetupMiddlewareFiberZerolog sets up structured access logging through the request logger.
+// The query string, and the headers and bodies when enabled, are redacted before logging.
+func SetupMiddlewareFiberZerolog(app *fiber.App, cfg *config.Config) {
+	redactor := newRedactor(cfg)
+
+	// Probes and scrapes would flood the access log
+	skipURIs := []string{health.LivePath, health.ReadyPath, health.StartupPath}
+	if cfg.MetricsEnabled {
+		skipURIs = append(skipURIs, cfg.MetricsPath)
 	}
 
-	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Stack().Logger()
 	app.Use(fiberzerolog.New(fiberzerolog.Config{
-		Logger: &logger,
-		Fields: []string{fiberzerolog.FieldIPs, fiberzerolog.FieldLatency, fiberzerolog.FieldStatus,
-			fiberzerolog.FieldMethod, fiberzerolog.FieldURL, fiberzerolog.FieldError},
+		SkipURIs: skipURIs,
+		GetLogger: func(c *fiber.Ctx) zerolog.Logger {
+			return accessLogger(c, cfg, redactor)
+		},
+		Fields: []string{fiberzerolog.FieldIP, fiberzerolog.FieldLatency, fiberzerolog.FieldStatus,
+			fiberzerolog.FieldMethod, fiberzerolog.FieldPath, fiberzerolog.FieldError},
+	}))
+}
+
+// newRedactor builds the redactor from the default rules and the LOG_REDACT_* settings
+func newRedactor(cfg *config.Config) *logger.Redactor {
+	return logger.NewRedactor(logger.DefaultRedactionRules().Merge(logger.RedactionRules{
+		Headers: strings.Split(cfg.LogRedactHeaders, ","),
+		Fields:  strings.Split(cfg.LogRedactFields, ","),
+		Paths:   strings.Split(cfg.LogRedactPaths, ","),
 	}))
 }
+
+// accessLogger adds the redacted request details to the request logger
+func accessLogger(c *fiber.Ctx, cfg *config.Config, redactor *logger.Redactor) zerolog.Logger {
+	ctx := logger.FromCtx(c).With()
+
+	if query := redactor.Query(string(c.Request().URI().QueryString())); query != "" {
+		ctx = ctx.Str("query", query)
+	}
+
+	if cfg.LogHeaders {
+		headers := zerolog.Dict()
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			headers.Str(string(key), redactor.Header(string(key), string(value)))
+		})
+		ctx = ctx.Dict("req_headers", headers)
+	}
+
+	if cfg.LogBodies {
+		if body := redactor.Body(string(c.Request().Header.ContentType()), c.Body(), cfg.LogBodyMaxBytes); body != "" {
+			ctx = ctx.Str("req_body", body)
+		}
+		if body := redactor.Body(string(c.Response().Header.ContentType()), c.Response().Body(), cfg.LogBodyMaxBytes); body != "" {
+			ctx = ctx.Str("res_body", body)
+		}
+	}
+
+	return ctx.Logger()
+}
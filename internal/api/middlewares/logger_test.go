@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-boilerplate-api/internal/api/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/rs/zerolog"
+)
+
+// newLoggedApp returns an app logging to buf
+func newLoggedApp(cfg *config.Config, buf *bytes.Buffer) *fiber.App {
+	app := fiber.New()
+	app.Use(requestid.New())
+	SetupMiddlewareRequestLogger(app, zerolog.New(buf))
+	SetupMiddlewareFiberZerolog(app, cfg)
+
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"token": "resp-jwt-secret", "session_id": "s-1"})
+	})
+	return app
+}
+
+func TestAccessLogRedactsSecrets(t *testing.T) {
+	for _, logBodies := range []bool{false, true} {
+		var buf bytes.Buffer
+		app := newLoggedApp(&config.Config{
+			LogHeaders:      true,
+			LogBodies:       logBodies,
+			LogBodyMaxBytes: 2048,
+			LogRedactFields: "ssn",
+		}, &buf)
+
+		body := `{"email": "jane@example.com", "password": "body-password-secret", "ssn": "123-45-6789"}`
+		req := httptest.NewRequest(fiber.MethodPost, "/login?reset_token=query-token-secret&page=1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer header-jwt-secret")
+		req.Header.Set("Cookie", "session=cookie-secret")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+
+		logged := buf.String()
+		if logged == "" {
+			t.Fatal("nothing was logged")
+		}
+		for _, secret := range []string{
+			"jane@example.com", "body-password-secret", "123-45-6789", "query-token-secret",
+			"header-jwt-secret", "cookie-secret", "resp-jwt-secret",
+		} {
+			if strings.Contains(logged, secret) {
+				t.Errorf("LogBodies=%v: log contains %q:\n%s", logBodies, secret, logged)
+			}
+		}
+		if !strings.Contains(logged, "request_id") || !strings.Contains(logged, "page=1") {
+			t.Errorf("LogBodies=%v: log is missing the request ID or query:\n%s", logBodies, logged)
+		}
+		if logBodies && !strings.Contains(logged, "s-1") {
+			t.Errorf("LogBodies=true: response body was not logged:\n%s", logged)
+		}
+	}
+}
+
+func TestAccessLogOmitsBodiesByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	app := newLoggedApp(&config.Config{LogBodyMaxBytes: 2048}, &buf)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/login", strings.NewReader(`{"username": "jane"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	if logged := buf.String(); strings.Contains(logged, "req_body") || strings.Contains(logged, "req_headers") {
+		t.Errorf("bodies and headers logged without LOG_BODIES/LOG_HEADERS:\n%s", logged)
+	}
+}
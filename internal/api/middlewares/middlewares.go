@@ -1,8 +1,13 @@
 package middlewares
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"go-boilerplate-api/internal/api/config"
 
-func SetupMiddlewares(app *fiber.App) {
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+func SetupMiddlewares(app *fiber.App, cfg *config.Config, reloader *config.Reloader, log zerolog.Logger) {
 	// app.Use()
-	SetupMiddlewaresEssentials(app)
+	SetupMiddlewaresEssentials(app, cfg, reloader, log)
 }
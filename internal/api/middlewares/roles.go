@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"errors"
+
+	"go-boilerplate-api/internal/api/db"
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// RequireRole only lets active users with the given role through.
+// It must run after Protected. The role is read from the primary database so that
+// demotions apply immediately instead of waiting for the token to expire or a replica to
+// catch up.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := helpers.GetClaimStr(c, "sub")
+		if err != nil {
+			return helpers.SendUnauthorized(c, "Invalid token claims")
+		}
+
+		if db.DB == nil {
+			return helpers.SendError(c, fiber.StatusServiceUnavailable, "service_unavailable", "Database is not configured")
+		}
+
+		var user models.User
+		err = db.DB.WithContext(c.UserContext()).Clauses(dbresolver.Write).Select("id", "role", "status").First(&user, "id = ?", userID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.SendForbidden(c, "Insufficient permissions")
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.Role != role || user.Status != models.UserStatusActive {
+			return helpers.SendForbidden(c, "Insufficient permissions")
+		}
+
+		return c.Next()
+	}
+}
@@ -1,26 +1,42 @@
 package routes
 
 import (
+	"go-boilerplate-api/internal/api/config"
 	"go-boilerplate-api/internal/api/handlers"
+	"go-boilerplate-api/internal/api/health"
+	"go-boilerplate-api/internal/api/metrics"
+	"go-boilerplate-api/internal/api/middlewares"
 	"go-boilerplate-api/shared/helpers"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, cfg *config.Config, registry *health.Registry) {
 	// Root API endpoint
 	app.Get("/", func(c *fiber.Ctx) error {
 		return helpers.SendOK(c, nil, "Service is operational")
 	})
 
+	// Kubernetes probes. ?verbose adds per-check results, with errors and pool
+	// statistics only for authenticated callers.
+	optionalAuth := middlewares.OptionalProtected(cfg)
+	app.Get(health.LivePath, handlers.Livez(registry))
+	app.Get(health.ReadyPath, optionalAuth, handlers.Readyz(registry))
+	app.Get(health.StartupPath, optionalAuth, handlers.Startupz(registry))
+
 	// API routes
 	api := app.Group("/api")
 
-	// Health check route
-	api.Get("/health", handlers.Health)
+	// Deprecated: use /readyz
+	api.Get("/health", optionalAuth, handlers.Readyz(registry))
+
+	// Prometheus metrics, unless served on a separate METRICS_PORT
+	if cfg.MetricsEnabled && cfg.MetricsPort == "" {
+		app.Get(cfg.MetricsPath, metrics.Handler())
+	}
 
 	// v1 API routes
-	SetupV1Routes(api)
+	SetupV1Routes(api, cfg)
 
 	// WebSocket routes
 	SetupWebSocketRoutes(app)
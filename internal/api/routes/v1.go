@@ -1,14 +1,41 @@
 package routes
 
 import (
+	"go-boilerplate-api/internal/api/config"
 	"go-boilerplate-api/internal/api/handlers"
+	"go-boilerplate-api/internal/api/middlewares"
+	"go-boilerplate-api/shared/models"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // SetupV1Routes configures v1 API routes
-func SetupV1Routes(api fiber.Router) {
+func SetupV1Routes(api fiber.Router, cfg *config.Config) {
 	v1 := api.Group("/v1")
+	protected := middlewares.Protected(cfg)
 
-	v1.Post("/login", handlers.LoginHandler)
+	v1.Post("/login", handlers.LoginHandler(cfg))
+	v1.Post("/email/verify", handlers.VerifyEmailChange)
+
+	// Authenticated user routes
+	me := v1.Group("/me", protected)
+	me.Get("/", handlers.GetMe)
+	me.Patch("/", handlers.UpdateMe)
+	me.Delete("/", middlewares.DenyImpersonation, handlers.DeleteMe(cfg))
+	me.Post("/deactivate", middlewares.DenyImpersonation, handlers.DeactivateMe)
+	me.Get("/export", middlewares.DenyImpersonation, handlers.ExportMe)
+	me.Post("/email", middlewares.DenyImpersonation, handlers.RequestEmailChange(cfg))
+	me.Post("/password", middlewares.DenyImpersonation, handlers.ChangePassword)
+	me.Get("/sessions", handlers.ListSessions)
+	me.Delete("/sessions/:id", middlewares.DenyImpersonation, handlers.RevokeSession)
+
+	// Admin routes
+	admin := v1.Group("/admin", protected, middlewares.RequireRole(models.UserRoleAdmin))
+	admin.Get("/users", handlers.AdminListUsers)
+	admin.Get("/users/:id", handlers.AdminGetUser)
+	admin.Patch("/users/:id", handlers.AdminUpdateUser)
+	admin.Post("/users/:id/disable", handlers.AdminDisableUser)
+	admin.Post("/users/:id/enable", handlers.AdminEnableUser)
+	admin.Delete("/users/:id", handlers.AdminDeleteUser)
+	admin.Post("/users/:id/impersonate", handlers.AdminImpersonateUser(cfg))
 }
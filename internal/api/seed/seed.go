@@ -0,0 +1,237 @@
+// Package seed loads fixture files and inserts them through the GORM models, so developers get
+// working accounts without hand written SQL.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-boilerplate-api/shared/helpers"
+	"go-boilerplate-api/shared/models"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultDir is the directory holding <profile>.{yaml,yml,json} fixture files
+const DefaultDir = "seeds"
+
+var fixtureExtensions = []string{".yaml", ".yml", ".json"}
+
+// Fixtures is the content of a fixture file
+type Fixtures struct {
+	Users []UserFixture `yaml:"users" json:"users"`
+}
+
+// UserFixture is a user to create or update, matched by email
+type UserFixture struct {
+	Email         string `yaml:"email" json:"email" validate:"required,email"`
+	Password      string `yaml:"password" json:"password" validate:"required,min=8,max=72"`
+	FirstName     string `yaml:"first_name" json:"first_name" validate:"max=100"`
+	LastName      string `yaml:"last_name" json:"last_name" validate:"max=100"`
+	Role          string `yaml:"role" json:"role" validate:"omitempty,oneof=user admin"`
+	Status        string `yaml:"status" json:"status" validate:"omitempty,oneof=active disabled deactivated"`
+	EmailVerified bool   `yaml:"email_verified" json:"email_verified"`
+}
+
+// Result counts the fixture users of Apply by outcome
+type Result struct {
+	Created int
+	Updated int
+	// Unchanged users already matched their fixture and were not written
+	Unchanged int
+}
+
+// upsertOutcome is what upsertUser did with a fixture
+type upsertOutcome int
+
+const (
+	outcomeCreated upsertOutcome = iota
+	outcomeUpdated
+	outcomeUnchanged
+)
+
+// FindFile returns the fixture file of profile in dir, listing the available profiles when
+// there is none
+func FindFile(dir, profile string) (string, error) {
+	for _, ext := range fixtureExtensions {
+		path := filepath.Join(dir, profile+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	var available []string
+	for _, ext := range fixtureExtensions {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+ext))
+		for _, match := range matches {
+			available = append(available, strings.TrimSuffix(filepath.Base(match), ext))
+		}
+	}
+	return "", fmt.Errorf("no fixtures for profile %q in %s (available: %s)", profile, dir, strings.Join(available, ", "))
+}
+
+// Load reads and validates a YAML or JSON fixture file. Unknown keys are rejected so typos
+// do not silently drop data.
+func Load(path string) (*Fixtures, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var fixtures Fixtures
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fixtures)
+		if errors.Is(err, io.EOF) {
+			err = nil // Empty file
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fixtures)
+	default:
+		return nil, fmt.Errorf("%s: unsupported fixture format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	emails := map[string]bool{}
+	for i, user := range fixtures.Users {
+		if err := helpers.ValidateStruct(user); err != nil {
+			return nil, fmt.Errorf("%s: users[%d]: %w", path, i, err)
+		}
+		email := normalizeEmail(user.Email)
+		if emails[email] {
+			return nil, fmt.Errorf("%s: users[%d]: duplicate email %s", path, i, email)
+		}
+		emails[email] = true
+	}
+	return &fixtures, nil
+}
+
+// Apply upserts the fixtures in one transaction. Users are matched by email, and soft deleted
+// or anonymized users are restored. Users already matching their fixture are not written, and
+// password hashes are kept when the password is unchanged, so running it twice writes nothing
+// the second time. Changing the password of a user revokes their open sessions.
+func Apply(ctx context.Context, gormDB *gorm.DB, fixtures *Fixtures) (Result, error) {
+	var result Result
+	err := gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, fixture := range fixtures.Users {
+			outcome, err := upsertUser(tx, fixture)
+			if err != nil {
+				return fmt.Errorf("failed to seed user %s: %w", fixture.Email, err)
+			}
+			switch outcome {
+			case outcomeCreated:
+				result.Created++
+			case outcomeUpdated:
+				result.Updated++
+			case outcomeUnchanged:
+				result.Unchanged++
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// upsertUser creates or updates the user of fixture, unless it already matches
+func upsertUser(tx *gorm.DB, fixture UserFixture) (upsertOutcome, error) {
+	email := normalizeEmail(fixture.Email)
+
+	var existing models.User
+	err := tx.Unscoped().Where("email = ?", email).Take(&existing).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	hash := existing.PasswordHash
+	if !found || !helpers.CheckPassword(hash, fixture.Password) {
+		if hash, err = helpers.HashPassword(fixture.Password); err != nil {
+			return 0, err
+		}
+	}
+
+	user := models.User{
+		Email:        email,
+		FirstName:    fixture.FirstName,
+		LastName:     fixture.LastName,
+		PasswordHash: hash,
+		Role:         defaultString(fixture.Role, models.UserRoleUser),
+		Status:       defaultString(fixture.Status, models.UserStatusActive),
+	}
+	if fixture.EmailVerified {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+		if existing.EmailVerifiedAt != nil {
+			user.EmailVerifiedAt = existing.EmailVerifiedAt
+		}
+	}
+
+	if found && matchesFixture(existing, user) {
+		return outcomeUnchanged, nil
+	}
+
+	err = tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"first_name", "last_name", "password_hash", "role", "status",
+			"email_verified_at", "deleted_at", "anonymized_at", "updated_at",
+		}),
+	}).Create(&user).Error
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return outcomeCreated, nil
+	}
+
+	// Tokens issued with the old password must stop working, as with a password change
+	if hash != existing.PasswordHash {
+		err = tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", existing.ID).
+			Update("revoked_at", time.Now().UTC()).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return outcomeUpdated, nil
+}
+
+// matchesFixture reports whether the existing user already holds the values upsertUser would
+// write for user
+func matchesFixture(existing, user models.User) bool {
+	return existing.FirstName == user.FirstName &&
+		existing.LastName == user.LastName &&
+		existing.PasswordHash == user.PasswordHash &&
+		existing.Role == user.Role &&
+		existing.Status == user.Status &&
+		(existing.EmailVerifiedAt != nil) == (user.EmailVerifiedAt != nil) &&
+		!existing.DeletedAt.Valid &&
+		existing.AnonymizedAt == nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
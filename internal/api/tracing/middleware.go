@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+
+	"go-boilerplate-api/shared/helpers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier adapts fasthttp request headers to the OpenTelemetry propagators
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (h headerCarrier) Get(key string) string {
+	return string(h.header.Peek(key))
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Middleware starts a server span per request, continuing the trace of an incoming W3C
+// traceparent header. The span is stored in c.UserContext() so database and Redis spans
+// created with that context become its children. Requests for which skip returns true are
+// not traced; skip may be nil.
+func Middleware(skip func(c *fiber.Ctx) bool) fiber.Handler {
+	tracer := Tracer()
+
+	return func(c *fiber.Ctx) error {
+		if skip != nil && skip(c) {
+			return c.Next()
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+		ctx, span := tracer.Start(ctx, "HTTP "+c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+				attribute.String("client.address", c.IP()),
+				attribute.String("user_agent.original", c.Get(fiber.HeaderUserAgent)),
+			),
+		)
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+			span.RecordError(err)
+		}
+
+		// Unmatched paths keep the generic name so span names stay low-cardinality
+		if route := helpers.RouteTemplate(c, status); route != "" {
+			span.SetName(c.Method() + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+
+		return err
+	}
+}
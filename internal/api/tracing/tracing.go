@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters selectable with TRACING_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// instrumentationName identifies the spans created by this package
+const instrumentationName = "go-boilerplate-api"
+
+// Options configures tracing
+type Options struct {
+	// Exporter is ExporterNone, ExporterStdout or ExporterOTLP
+	Exporter string
+	// ServiceName is reported as service.name
+	ServiceName string
+	// Environment is reported as deployment.environment.name
+	Environment string
+	// SampleRatio is the fraction of new traces recorded. Requests carrying a sampled
+	// traceparent are always recorded.
+	SampleRatio float64
+	// OTLPEndpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318.
+	// When empty, the standard OTEL_EXPORTER_OTLP_* variables are used.
+	OTLPEndpoint string
+}
+
+// Init installs the global tracer provider and the W3C trace context propagator.
+// The returned function flushes pending spans and must be called on shutdown.
+// With ExporterNone no spans are recorded, but incoming trace IDs are still propagated.
+func Init(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = e
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		e, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", opts.ServiceName),
+		attribute.String("deployment.environment.name", opts.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for application spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceID returns the trace ID of the span in ctx, or "" if there is none
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
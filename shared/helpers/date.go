@@ -1,12 +1,11 @@
 package helpers
 
 import (
-	"go-boilerplate-api/internal/api/config"
 	"time"
 )
 
-func GetTodayDate() string {
-	loc, err := time.LoadLocation(config.TIMEZONE)
+func GetTodayDate(timezone string) string {
+	loc, err := time.LoadLocation(timezone)
 	if err != nil {
 		loc, _ = time.LoadLocation("UTC")
 	}
@@ -14,8 +13,8 @@ func GetTodayDate() string {
 	return today.Format("2006-01-02")
 }
 
-func IsDateToday(date string) bool {
-	loc, err := time.LoadLocation(config.TIMEZONE)
+func IsDateToday(date string, timezone string) bool {
+	loc, err := time.LoadLocation(timezone)
 	if err != nil {
 		loc, _ = time.LoadLocation("UTC")
 	}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"fmt"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -22,3 +23,47 @@ func ExtractClaimsStr(key string, tokenRaw any) (string, error) {
 
 	return val, nil
 }
+
+// GetClaimStr returns a string claim from the claims stored by middlewares.Protected
+func GetClaimStr(c *fiber.Ctx, key string) (string, error) {
+	claims, ok := c.Locals("user").(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("error getting claims from request context")
+	}
+	val, ok := claims[key].(string)
+	if !ok || val == "" {
+		return "", fmt.Errorf("error getting claims with key %s, got %v", key, val)
+	}
+
+	return val, nil
+}
+
+// ActorFromClaims returns the id of the user actually holding the token.
+// Impersonation tokens carry it in the act claim (RFC 8693), other tokens in sub.
+func ActorFromClaims(claims jwt.MapClaims) string {
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		if sub, ok := act["sub"].(string); ok && sub != "" {
+			return sub
+		}
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// GetSubjectID returns the id of the user the request acts as, set by middlewares.Protected
+func GetSubjectID(c *fiber.Ctx) string {
+	id, _ := c.Locals("subject_id").(string)
+	return id
+}
+
+// GetActorID returns the id of the user actually making the request, set by middlewares.Protected.
+// It differs from GetSubjectID only while impersonating.
+func GetActorID(c *fiber.Ctx) string {
+	id, _ := c.Locals("actor_id").(string)
+	return id
+}
+
+// IsImpersonating reports whether the request was made with an impersonation token
+func IsImpersonating(c *fiber.Ctx) bool {
+	return GetActorID(c) != GetSubjectID(c)
+}
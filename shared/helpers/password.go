@@ -0,0 +1,22 @@
+package helpers
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword hashes a password with bcrypt for storage in users.password_hash
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password err: %v", err)
+	}
+
+	return string(hashed), nil
+}
+
+// CheckPassword reports whether password matches the stored bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
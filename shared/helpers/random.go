@@ -0,0 +1,24 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// GenerateSecureToken returns a random hex-encoded token suitable for one-time links
+func GenerateSecureToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating secure token err: %v", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 of a token for storage and lookup
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
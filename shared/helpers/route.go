@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handlerRoutesByApp caches, per app, the routes registered with a handler, excluding app.Use
+var handlerRoutesByApp sync.Map
+
+// RouteTemplate returns the registered path of the last matched route, e.g. /api/v1/admin/users/:id.
+// A request stopped by a group middleware returns the group prefix, and a 404 that reached no
+// handler route returns "". Routes must all be registered before the first call for an app.
+func RouteTemplate(c *fiber.Ctx, status int) string {
+	route := c.Route()
+	if route == nil || route.Path == "" {
+		return ""
+	}
+	if status == fiber.StatusNotFound && (len(route.Handlers) == 0 || !handlerRoutes(c.App())[&route.Handlers[0]]) {
+		return ""
+	}
+	return route.Path
+}
+
+// handlerRoutes identifies handler routes by their handler slice. Paths cannot be used
+// because app.Use("/") and app.Get("/") share one.
+func handlerRoutes(app *fiber.App) map[*fiber.Handler]bool {
+	if routes, ok := handlerRoutesByApp.Load(app); ok {
+		return routes.(map[*fiber.Handler]bool)
+	}
+
+	routes := map[*fiber.Handler]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if len(route.Handlers) > 0 {
+			routes[&route.Handlers[0]] = true
+		}
+	}
+	handlerRoutesByApp.Store(app, routes)
+	return routes
+}
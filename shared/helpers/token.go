@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GenerateToken signs a JWT for the user, bound to the given session id
+func GenerateToken(secretKey, userID, sessionID string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"iat": time.Now().Unix(),
+		"exp": expiresAt.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secretKey))
+}
+
+// GenerateImpersonationToken signs a JWT acting as subjectID on behalf of actorID.
+// The token is bound to the actor's session so revoking it also ends the impersonation.
+func GenerateImpersonationToken(secretKey, subjectID, actorID, sessionID string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": subjectID,
+		"act": map[string]interface{}{"sub": actorID},
+		"sid": sessionID,
+		"iat": time.Now().Unix(),
+		"exp": expiresAt.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secretKey))
+}
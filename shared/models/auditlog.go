@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Impersonation audit actions
+const (
+	ImpersonationActionStart   = "start"
+	ImpersonationActionRequest = "request"
+)
+
+// ImpersonationAuditLog records impersonation tokens being issued and every request made with them
+type ImpersonationAuditLog struct {
+	ID         string    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ActorID    string    `json:"actor_id" gorm:"type:uuid;not null;index"`
+	SubjectID  string    `json:"subject_id" gorm:"type:uuid;not null;index"`
+	SessionID  *string   `json:"session_id" gorm:"type:uuid"`
+	Action     string    `json:"action" gorm:"type:varchar(20);not null"`
+	Method     string    `json:"method" gorm:"type:varchar(10)"`
+	Path       string    `json:"path" gorm:"type:varchar(2048)"`
+	StatusCode int       `json:"status_code" gorm:"type:integer"`
+	IPAddress  string    `json:"ip_address" gorm:"type:varchar(45)"`
+	RequestID  string    `json:"request_id" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for GORM
+func (ImpersonationAuditLog) TableName() string {
+	return "impersonation_audit_logs"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (l *ImpersonationAuditLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailChangeRequest represents a pending change of a user's email address.
+// Only the SHA-256 hash of the verification token is stored.
+type EmailChangeRequest struct {
+	ID          string     `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID      string     `json:"user_id" gorm:"type:uuid;not null;index"`
+	NewEmail    string     `json:"new_email" gorm:"type:varchar(255);not null"`
+	TokenHash   string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// TableName specifies the table name for GORM
+func (EmailChangeRequest) TableName() string {
+	return "email_change_requests"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (r *EmailChangeRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package models
+
+// All returns every model backed by a table, used to compare the models with the database
+func All() []any {
+	return []any{
+		&User{},
+		&Session{},
+		&EmailChangeRequest{},
+		&ImpersonationAuditLog{},
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session represents a login session, referenced by the sid claim of issued tokens
+type Session struct {
+	ID         string     `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID     string     `json:"user_id" gorm:"type:uuid;not null;index"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(512)"`
+	IPAddress  string     `json:"ip_address" gorm:"type:varchar(45)"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TableName specifies the table name for GORM
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IsActive reports whether the session can still authenticate requests
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
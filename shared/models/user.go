@@ -7,15 +7,34 @@ import (
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
+// User account statuses
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	// UserStatusDeactivated is set by users closing their own account
+	UserStatusDeactivated = "deactivated"
+)
+
 // User represents a user in the database
 type User struct {
-	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
-	Email     string    `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
-	FirstName string    `json:"first_name" gorm:"type:varchar(100)"`
-	LastName  string    `json:"last_name" gorm:"type:varchar(100)"`
-	PasswordHash string `json:"-" gorm:"type:varchar(255);not null;column:password_hash"`
-	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID              string         `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	Email           string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
+	FirstName       string         `json:"first_name" gorm:"type:varchar(100)"`
+	LastName        string         `json:"last_name" gorm:"type:varchar(100)"`
+	PasswordHash    string         `json:"-" gorm:"type:varchar(255);not null;column:password_hash"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`
+	Role            string         `json:"role" gorm:"type:varchar(50);not null;default:user"`
+	Status          string         `json:"status" gorm:"type:varchar(20);not null;default:active;index"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	AnonymizedAt    *time.Time     `json:"-"`
 }
 
 // TableName specifies the table name for GORM